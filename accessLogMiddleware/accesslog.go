@@ -0,0 +1,117 @@
+// Package accessLogMiddleware logs one entry per request.
+package accessLogMiddleware // import "github.com/teamwork/middleware/accessLogMiddleware"
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"time"
+)
+
+// Entry is a single access log entry.
+type Entry struct {
+	Method   string
+	Path     string
+	Status   int
+	Size     int64 // Bytes written to the client.
+	Start    time.Time
+	Duration time.Duration
+
+	// Fields from Config.ExtraFields.
+	Fields map[string]interface{}
+}
+
+// String formats the entry as a single line.
+func (e Entry) String() string {
+	s := fmt.Sprintf("%s %s %d %d %v", e.Method, e.Path, e.Status, e.Size, e.Duration)
+
+	keys := make([]string, 0, len(e.Fields))
+	for k := range e.Fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		s += fmt.Sprintf(" %s=%v", k, e.Fields[k])
+	}
+	return s
+}
+
+// Config for the middleware.
+type Config struct {
+	// Log the entry; the default is to print it to stderr.
+	Log func(*http.Request, Entry)
+
+	// ExtraFields can be used to add extra fields to the log (such as perhaps
+	// a installation ID or user ID from the session). It's called after the
+	// handler returns.
+	ExtraFields func(*http.Request) map[string]interface{}
+
+	// Skipper skips logging the request if it returns true, e.g. for health
+	// checks.
+	Skipper func(*http.Request) bool
+}
+
+// Helper function to make it easier to test.
+var now = func() time.Time { return time.Now() }
+
+// Add the access log middleware with the default config.
+func Add(next http.Handler) http.Handler {
+	return WithConfig(Config{})(next)
+}
+
+// WithConfig returns an access log middleware from config.
+//
+// The size is the number of bytes written to the ResponseWriter this
+// middleware gets, so add it before (outside of) gzipMiddleware to log the
+// compressed size.
+func WithConfig(config Config) func(http.Handler) http.Handler {
+	if config.Log == nil {
+		config.Log = defaultLog
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if config.Skipper != nil && config.Skipper(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			start := now()
+			rw := &responseWriter{ResponseWriter: w}
+			done := false
+			defer func() {
+				e := Entry{
+					Method:   r.Method,
+					Status:   rw.status,
+					Size:     rw.size,
+					Start:    start,
+					Duration: now().Sub(start),
+				}
+				if r.URL != nil {
+					e.Path = r.URL.Path
+				}
+				switch {
+				case e.Status != 0 || rw.hijacked:
+				case !done:
+					// The handler panic()ed; this will be a 500 if
+					// rescueMiddleware is added before this middleware.
+					e.Status = http.StatusInternalServerError
+				default:
+					e.Status = http.StatusOK
+				}
+				if config.ExtraFields != nil {
+					e.Fields = config.ExtraFields(r)
+				}
+				config.Log(r, e)
+			}()
+
+			next.ServeHTTP(rw, r)
+			done = true
+		})
+	}
+}
+
+func defaultLog(r *http.Request, e Entry) {
+	fmt.Fprintln(os.Stderr, e.String())
+}
@@ -0,0 +1,121 @@
+package accessLogMiddleware
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/teamwork/middleware/gzipMiddleware"
+	"github.com/teamwork/middleware/rescueMiddleware"
+	"github.com/teamwork/test"
+)
+
+type handle struct{}
+
+func (h handle) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	_, _ = w.Write([]byte("handler"))
+}
+
+func TestAccessLog(t *testing.T) {
+	start := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	calls := 0
+	oldNow := now
+	now = func() time.Time {
+		calls++
+		return start.Add(time.Duration(calls-1) * time.Second)
+	}
+	defer func() { now = oldNow }()
+
+	cases := []struct {
+		handler http.Handler
+		want    Entry
+	}{
+		{handle{}, Entry{Method: "GET", Path: "/foo", Status: 200, Size: 7}},
+		{http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte("not found"))
+		}), Entry{Method: "GET", Path: "/foo", Status: 404, Size: 9}},
+		{http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+			Entry{Method: "GET", Path: "/foo", Status: 200}},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%v", i), func(t *testing.T) {
+			calls = 0
+			var got Entry
+			req := &http.Request{Method: "GET", URL: &url.URL{Path: "/foo"}}
+			test.HTTP(t, req, WithConfig(Config{
+				Log: func(r *http.Request, e Entry) { got = e },
+				ExtraFields: func(r *http.Request) map[string]interface{} {
+					return map[string]interface{}{"user": 42}
+				},
+			})(tc.handler).ServeHTTP)
+
+			tc.want.Start = start
+			tc.want.Duration = time.Second
+			tc.want.Fields = map[string]interface{}{"user": 42}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("\nout:  %#v\nwant: %#v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestSkipper(t *testing.T) {
+	logged := false
+	test.HTTP(t, &http.Request{Method: "GET", URL: &url.URL{Path: "/health"}}, WithConfig(Config{
+		Log:     func(r *http.Request, e Entry) { logged = true },
+		Skipper: func(r *http.Request) bool { return r.URL.Path == "/health" },
+	})(handle{}).ServeHTTP)
+
+	if logged {
+		t.Error("logged skipped request")
+	}
+}
+
+func TestGzip(t *testing.T) {
+	var got Entry
+	req := &http.Request{Method: "GET", URL: &url.URL{Path: "/"},
+		Header: http.Header{"Accept-Encoding": {"gzip"}}}
+	rr := test.HTTP(t, req, WithConfig(Config{
+		Log: func(r *http.Request, e Entry) { got = e },
+	})(gzipMiddleware.Add(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(strings.Repeat("handler ", 1000)))
+	}))).ServeHTTP)
+
+	if got.Size != int64(rr.Body.Len()) {
+		t.Errorf("size: %d; want: %d", got.Size, rr.Body.Len())
+	}
+}
+
+func TestPanic(t *testing.T) {
+	var got Entry
+	req := &http.Request{Method: "GET", URL: &url.URL{Path: "/"}}
+	rr := test.HTTP(t, req, rescueMiddleware.WithConfig(rescueMiddleware.Config{
+		Log: func(*http.Request, error) {},
+	})(WithConfig(Config{
+		Log: func(r *http.Request, e Entry) { got = e },
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("oh noes")
+	}))).ServeHTTP)
+
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("code: %v", rr.Code)
+	}
+	if got.Status != http.StatusInternalServerError {
+		t.Errorf("logged status: %v; want: %v", got.Status, http.StatusInternalServerError)
+	}
+}
+
+func TestEntryString(t *testing.T) {
+	e := Entry{Method: "GET", Path: "/", Status: 200, Size: 7, Duration: time.Millisecond,
+		Fields: map[string]interface{}{"b": 2, "a": 1}}
+	want := "GET / 200 7 1ms a=1 b=2"
+	if s := e.String(); s != want {
+		t.Errorf("\nout:  %q\nwant: %q", s, want)
+	}
+}
@@ -2,6 +2,7 @@
 package authMiddleware
 
 import (
+	"crypto/sha256"
 	"crypto/subtle"
 	"fmt"
 	"net/http"
@@ -9,28 +10,63 @@ import (
 
 // Options for auth.
 type Options struct {
+	// Username and Password to allow; these are ignored if Validator is set.
 	Username string
 	Password string
-	Realm    string
+
+	// Validator checks the credentials, e.g. against a database. The
+	// comparison should take constant time; use Credentials for a single
+	// username and password.
+	Validator func(user, pass string) bool
+
+	// Realm to send in the WWW-Authenticate header; the default is
+	// "Restricted".
+	Realm string
+
+	// Skipper skips authentication if it returns true, e.g. to only require
+	// authentication for some paths.
+	Skipper func(*http.Request) bool
+}
+
+// Credentials returns a Validator for a single username and password. It uses
+// constant-time comparison to prevent timing attacks.
+func Credentials(username, password string) func(user, pass string) bool {
+	// Compare hashes so the time doesn't leak the lengths either.
+	wantUser := sha256.Sum256([]byte(username))
+	wantPass := sha256.Sum256([]byte(password))
+
+	return func(user, pass string) bool {
+		u := sha256.Sum256([]byte(user))
+		p := sha256.Sum256([]byte(pass))
+
+		// Don't short-circuit, so a wrong username takes as long as a wrong
+		// password.
+		userOK := subtle.ConstantTimeCompare(u[:], wantUser[:])
+		passOK := subtle.ConstantTimeCompare(p[:], wantPass[:])
+		return userOK&passOK == 1
+	}
 }
 
 // Auth adds HTTP Basic authentication.
 func Auth(opts Options) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
-		username := []byte(opts.Username)
-		password := []byte(opts.Password)
+		validator := opts.Validator
+		if validator == nil {
+			validator = Credentials(opts.Username, opts.Password)
+		}
 		realm := `Basic realm="Restricted"`
 		if opts.Realm != "" {
-			realm = fmt.Sprintf(`Basic realm="%v"`, opts.Realm)
+			realm = fmt.Sprintf(`Basic realm=%q`, opts.Realm)
 		}
 
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			user, pass, ok := r.BasicAuth()
-
-			if !ok ||
-				subtle.ConstantTimeCompare([]byte(user), username) != 1 ||
-				subtle.ConstantTimeCompare([]byte(pass), password) != 1 {
+			if opts.Skipper != nil && opts.Skipper(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
 
+			user, pass, ok := r.BasicAuth()
+			if !ok || !validator(user, pass) {
 				w.Header().Set("WWW-Authenticate", realm)
 				w.WriteHeader(http.StatusUnauthorized)
 				_, _ = w.Write([]byte("Unauthorised.\n"))
@@ -3,6 +3,7 @@ package authMiddleware
 import (
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 )
 
@@ -59,3 +60,67 @@ func TestAuth(t *testing.T) {
 		})
 	}
 }
+
+func TestAuthValidator(t *testing.T) {
+	opts := Options{
+		Validator: func(user, pass string) bool { return user == "asd" && pass == "qwe" },
+		Realm:     "Admin",
+		Skipper: func(r *http.Request) bool {
+			return !strings.HasPrefix(r.URL.Path, "/admin/")
+		},
+	}
+
+	cases := []struct {
+		path               string
+		username, password string
+		expectedCode       int
+	}{
+		{"/admin/x", "asd", "qwe", http.StatusOK},
+		{"/admin/x", "asd", "qweX", http.StatusUnauthorized},
+		{"/admin/x", "", "", http.StatusUnauthorized},
+		{"/public", "", "", http.StatusOK},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.path+tc.username+tc.password, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			req, err := http.NewRequest("GET", tc.path, nil)
+			if err != nil {
+				t.Fatalf("cannot make request: %v", err)
+			}
+			if tc.username != "" || tc.password != "" {
+				req.SetBasicAuth(tc.username, tc.password)
+			}
+
+			Auth(opts)(handle{}).ServeHTTP(rr, req)
+			if rr.Code != tc.expectedCode {
+				t.Errorf("wrong status code: expected %v, got %v",
+					tc.expectedCode, rr.Code)
+			}
+			if rr.Code == http.StatusUnauthorized {
+				if h := rr.Header().Get("WWW-Authenticate"); h != `Basic realm="Admin"` {
+					t.Errorf("wrong WWW-Authenticate: %q", h)
+				}
+			}
+		})
+	}
+}
+
+func TestCredentials(t *testing.T) {
+	v := Credentials("asd", "qwe")
+	cases := []struct {
+		user, pass string
+		want       bool
+	}{
+		{"asd", "qwe", true},
+		{"asd", "qw", false},
+		{"as", "qwe", false},
+		{"", "", false},
+		{"qwe", "asd", false},
+	}
+	for _, tc := range cases {
+		if got := v(tc.user, tc.pass); got != tc.want {
+			t.Errorf("Credentials(%q, %q) = %t; want: %t", tc.user, tc.pass, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+// Package bodyLimitMiddleware limits the size of request bodies.
+package bodyLimitMiddleware // import "github.com/teamwork/middleware/bodyLimitMiddleware"
+
+import (
+	"net/http"
+)
+
+// Config for the middleware.
+type Config struct {
+	// Limit is the maximum body size in bytes.
+	Limit int64
+
+	// LimitFunc gets the limit for a request, e.g. to allow larger bodies for
+	// file uploads. Limit is used if it returns 0, and there is no limit if
+	// it returns a negative number.
+	// Optional.
+	LimitFunc func(*http.Request) int64
+}
+
+// DefaultConfig is the default body limit middleware config.
+var DefaultConfig = Config{
+	Limit: 1 << 20, // 1M
+}
+
+// Add the body limit middleware with the DefaultConfig.
+func Add(next http.Handler) http.Handler {
+	return WithConfig(DefaultConfig)(next)
+}
+
+// WithConfig returns a body limit middleware from config.
+//
+// Requests with a Content-Length over the limit get a 413 Request Entity Too
+// Large response without calling the handler. Other requests (e.g. with
+// chunked encoding) can't be checked in advance: reading more than the limit
+// from r.Body returns an error in the handler, and sends the 413 response if
+// the handler didn't write anything yet. Anything the handler writes after
+// that is discarded.
+func WithConfig(config Config) func(http.Handler) http.Handler {
+	if config.Limit == 0 {
+		config.Limit = DefaultConfig.Limit
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			limit := config.Limit
+			if config.LimitFunc != nil {
+				if l := config.LimitFunc(r); l != 0 {
+					limit = l
+				}
+			}
+			if limit < 0 || r.Body == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if r.ContentLength > limit {
+				errorTooLarge(w)
+				return
+			}
+
+			rw := &responseWriter{ResponseWriter: w}
+			r.Body = &body{ReadCloser: http.MaxBytesReader(w, r.Body, limit), w: rw, limit: limit}
+			next.ServeHTTP(rw, r)
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package bodyLimitMiddleware
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/teamwork/test"
+)
+
+func TestBodyLimit(t *testing.T) {
+	config := Config{
+		Limit: 10,
+		LimitFunc: func(r *http.Request) int64 {
+			switch r.URL.Path {
+			case "/upload":
+				return 100
+			case "/unlimited":
+				return -1
+			}
+			return 0
+		},
+	}
+
+	cases := []struct {
+		path          string
+		body          string
+		contentLength bool
+		wantCode      int
+		wantCalled    bool
+		wantReadErr   bool
+	}{
+		{"/", "0123456789", true, 200, true, false},
+		{"/", "0123456789x", true, 413, false, false},
+		{"/", "0123456789x", false, 413, true, true},
+		{"/", "0123456789", false, 200, true, false},
+		{"/upload", strings.Repeat("x", 100), true, 200, true, false},
+		{"/upload", strings.Repeat("x", 101), true, 413, false, false},
+		{"/unlimited", strings.Repeat("x", 1000), true, 200, true, false},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%v", i), func(t *testing.T) {
+			req, err := http.NewRequest("POST", tc.path, strings.NewReader(tc.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !tc.contentLength {
+				req.ContentLength = -1
+			}
+
+			var (
+				called  bool
+				readErr error
+				body    []byte
+			)
+			rr := test.HTTP(t, req, WithConfig(config)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				called = true
+				body, readErr = ioutil.ReadAll(r.Body)
+			})).ServeHTTP)
+
+			if rr.Code != tc.wantCode {
+				t.Errorf("code: %v; want: %v", rr.Code, tc.wantCode)
+			}
+			if called != tc.wantCalled {
+				t.Fatalf("handler called: %t; want: %t", called, tc.wantCalled)
+			}
+			if !called {
+				return
+			}
+			if (readErr != nil) != tc.wantReadErr {
+				t.Errorf("read error: %v", readErr)
+			}
+			if !tc.wantReadErr && string(body) != tc.body {
+				t.Errorf("wrong body: %q", body)
+			}
+		})
+	}
+}
+
+func TestBodyLimitChunked(t *testing.T) {
+	cases := []struct {
+		name     string
+		handler  http.HandlerFunc
+		wantCode int
+		wantBody string
+	}{
+		{"handler error discarded", func(w http.ResponseWriter, r *http.Request) {
+			if _, err := ioutil.ReadAll(r.Body); err != nil {
+				http.Error(w, "bad body", http.StatusBadRequest)
+			}
+		}, 413, "Request Entity Too Large\n"},
+		{"written before read", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusAccepted)
+			_, _ = ioutil.ReadAll(r.Body)
+			_, _ = w.Write([]byte("handler"))
+		}, 202, "handler"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest("POST", "/", strings.NewReader(strings.Repeat("x", 11)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.ContentLength = -1
+
+			rr := test.HTTP(t, req, WithConfig(Config{Limit: 10})(tc.handler).ServeHTTP)
+			if rr.Code != tc.wantCode {
+				t.Errorf("code: %v; want: %v", rr.Code, tc.wantCode)
+			}
+			if b := rr.Body.String(); b != tc.wantBody {
+				t.Errorf("body: %q; want: %q", b, tc.wantBody)
+			}
+		})
+	}
+}
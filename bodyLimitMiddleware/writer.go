@@ -0,0 +1,76 @@
+package bodyLimitMiddleware
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+)
+
+// responseWriter records if the handler wrote anything, and discards the
+// handler's response once the 413 has been sent.
+type responseWriter struct {
+	http.ResponseWriter
+	written  bool
+	tooLarge bool
+}
+
+func (w *responseWriter) WriteHeader(code int) {
+	if w.tooLarge {
+		return
+	}
+	w.written = true
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *responseWriter) Write(b []byte) (int, error) {
+	if w.tooLarge {
+		return len(b), nil
+	}
+	w.written = true
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush implements http.Flusher.
+func (w *responseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		w.written = true
+		f.Flush()
+	}
+}
+
+// Hijack implements http.Hijacker.
+func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("bodyLimitMiddleware: %T is not a http.Hijacker", w.ResponseWriter)
+	}
+	w.written = true
+	return h.Hijack()
+}
+
+// body sends the 413 response once more than limit bytes are read, if the
+// handler didn't write anything yet.
+type body struct {
+	io.ReadCloser // http.MaxBytesReader
+	w             *responseWriter
+	limit, read   int64
+}
+
+func (b *body) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.read += int64(n)
+	// MaxBytesReader returns an error once it has read limit bytes and there
+	// is more data.
+	if err != nil && err != io.EOF && b.read >= b.limit && !b.w.written && !b.w.tooLarge {
+		errorTooLarge(b.w.ResponseWriter)
+		b.w.tooLarge = true
+	}
+	return n, err
+}
+
+func errorTooLarge(w http.ResponseWriter) {
+	http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge),
+		http.StatusRequestEntityTooLarge)
+}
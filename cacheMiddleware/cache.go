@@ -1,4 +1,5 @@
-// Package cacheMiddleware disables browser caching.
+// Package cacheMiddleware sets the Cache-Control header to control browser
+// caching.
 //
 // See: https://tools.ietf.org/html/rfc7234#section-5.2.1.4
 package cacheMiddleware // import "github.com/teamwork/middleware/cacheMiddleware"
@@ -2,8 +2,11 @@ package cacheMiddleware
 
 import (
 	"net/http"
+	"net/url"
 	"testing"
+	"time"
 
+	"github.com/teamwork/middleware/rescueMiddleware"
 	"github.com/teamwork/test"
 )
 
@@ -40,3 +43,59 @@ func TestNoStore(t *testing.T) {
 		t.Errorf("header wrong: %#v", h)
 	}
 }
+
+func TestWithConfig(t *testing.T) {
+	config := Config{
+		AssetPrefixes: []string{"/static/", "/favicon.ico"},
+		MaxAge:        time.Hour,
+		Immutable:     true,
+	}
+
+	cases := []struct {
+		path    string
+		handler http.Handler
+		want    string
+	}{
+		{"/static/app.js", handle{}, "public, max-age=3600, immutable"},
+		{"/favicon.ico", handle{}, "public, max-age=3600, immutable"},
+		{"/", handle{}, "no-store"},
+		{"/projects/static/", handle{}, "no-store"},
+		{"/static/app.abc123.js", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Cache-Control", "public, max-age=31536000")
+			_, _ = w.Write([]byte("handler"))
+		}), "public, max-age=31536000"},
+		{"/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), "no-store"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.path, func(t *testing.T) {
+			req := &http.Request{Method: "GET", URL: &url.URL{Path: tc.path}}
+			rr := test.HTTP(t, req, WithConfig(config)(tc.handler).ServeHTTP)
+			if h := rr.Header().Get("Cache-Control"); h != tc.want {
+				t.Errorf("header wrong: %#v; want: %#v", h, tc.want)
+			}
+		})
+	}
+}
+
+func TestPanic(t *testing.T) {
+	mw := rescueMiddleware.WithConfig(rescueMiddleware.Config{
+		Log: func(*http.Request, error) {},
+	})(WithConfig(Config{AssetPrefixes: []string{"/static/"}})(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			panic("oh noes")
+		})))
+
+	for _, path := range []string{"/", "/static/app.js"} {
+		t.Run(path, func(t *testing.T) {
+			req := &http.Request{Method: "GET", URL: &url.URL{Path: path}}
+			rr := test.HTTP(t, req, mw.ServeHTTP)
+			if rr.Code != http.StatusInternalServerError {
+				t.Errorf("code: %v", rr.Code)
+			}
+			if h := rr.Result().Header.Get("Cache-Control"); h != "no-store" {
+				t.Errorf("header wrong: %#v", h)
+			}
+		})
+	}
+}
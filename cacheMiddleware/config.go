@@ -0,0 +1,126 @@
+package cacheMiddleware
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config for WithConfig.
+type Config struct {
+	// AssetPrefixes are path prefixes of static assets, such as "/static/".
+	AssetPrefixes []string
+
+	// MaxAge for assets; the default is one year.
+	MaxAge time.Duration
+
+	// Immutable adds immutable to the Cache-Control header for assets, which
+	// tells browsers they never need to revalidate. Only use this if the
+	// asset URLs change when the content does (e.g. with a hash in the
+	// filename).
+	Immutable bool
+
+	// Dynamic is the Cache-Control header for everything else; the default is
+	// "no-store".
+	Dynamic string
+}
+
+// DefaultConfig is the default cache middleware config.
+var DefaultConfig = Config{
+	MaxAge:  365 * 24 * time.Hour,
+	Dynamic: "no-store",
+}
+
+// WithConfig sets the Cache-Control header for static assets and dynamic
+// pages. The header isn't changed if the handler already set it.
+func WithConfig(config Config) func(http.Handler) http.Handler {
+	if config.MaxAge == 0 {
+		config.MaxAge = DefaultConfig.MaxAge
+	}
+	if config.Dynamic == "" {
+		config.Dynamic = DefaultConfig.Dynamic
+	}
+
+	asset := "public, max-age=" + strconv.FormatInt(int64(config.MaxAge/time.Second), 10)
+	if config.Immutable {
+		asset += ", immutable"
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			cc := config.Dynamic
+			for _, p := range config.AssetPrefixes {
+				if r.URL != nil && strings.HasPrefix(r.URL.Path, p) {
+					cc = asset
+					break
+				}
+			}
+
+			// Deferred so the header is also set on the error page if the
+			// handler panics and a middleware before this one recovers it;
+			// that uses Dynamic, as error pages shouldn't be cached as assets.
+			rw := &responseWriter{ResponseWriter: w, cacheControl: cc}
+			done := false
+			defer func() {
+				if !done {
+					rw.cacheControl = config.Dynamic
+				}
+				rw.setHeader()
+			}()
+			next.ServeHTTP(rw, r)
+			done = true
+		})
+	}
+}
+
+// responseWriter sets the Cache-Control header just before the headers are
+// sent, if the handler didn't set it.
+type responseWriter struct {
+	http.ResponseWriter
+	cacheControl string
+	wroteHeader  bool
+	hijacked     bool
+}
+
+// setHeader sets the Cache-Control header if it's not set yet.
+func (w *responseWriter) setHeader() {
+	if w.wroteHeader || w.hijacked {
+		return
+	}
+	w.wroteHeader = true
+	if w.Header().Get("Cache-Control") == "" {
+		w.Header().Set("Cache-Control", w.cacheControl)
+	}
+}
+
+func (w *responseWriter) WriteHeader(code int) {
+	w.setHeader()
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *responseWriter) Write(b []byte) (int, error) {
+	w.setHeader()
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush implements http.Flusher.
+func (w *responseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		w.setHeader()
+		f.Flush()
+	}
+}
+
+// Hijack implements http.Hijacker.
+func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("cacheMiddleware: %T is not a http.Hijacker", w.ResponseWriter)
+	}
+	w.hijacked = true
+	return h.Hijack()
+}
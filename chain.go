@@ -0,0 +1,25 @@
+package middleware
+
+import "net/http"
+
+// Chain combines middlewares into one. The first middleware is the outermost
+// one, so it runs first on the request and last on the response:
+//
+//	Chain(a, b, c)(h)
+//
+// is the same as:
+//
+//	a(b(c(h)))
+func Chain(mws ...func(http.Handler) http.Handler) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		for i := len(mws) - 1; i >= 0; i-- {
+			h = mws[i](h)
+		}
+		return h
+	}
+}
+
+// Then applies the middlewares to h; this is the same as Chain(mws...)(h).
+func Then(h http.Handler, mws ...func(http.Handler) http.Handler) http.Handler {
+	return Chain(mws...)(h)
+}
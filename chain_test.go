@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/teamwork/test"
+)
+
+func TestChain(t *testing.T) {
+	var order []string
+	mw := func(name string) func(http.Handler) http.Handler {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				order = append(order, name+" before")
+				next.ServeHTTP(w, r)
+				order = append(order, name+" after")
+			})
+		}
+	}
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		order = append(order, "handler")
+	})
+
+	want := []string{"a before", "b before", "c before", "handler",
+		"c after", "b after", "a after"}
+
+	test.HTTP(t, nil, Chain(mw("a"), mw("b"), mw("c"))(h).ServeHTTP)
+	if !reflect.DeepEqual(order, want) {
+		t.Errorf("Chain\nout:  %v\nwant: %v", order, want)
+	}
+
+	order = nil
+	test.HTTP(t, nil, Then(h, mw("a"), mw("b"), mw("c")).ServeHTTP)
+	if !reflect.DeepEqual(order, want) {
+		t.Errorf("Then\nout:  %v\nwant: %v", order, want)
+	}
+
+	order = nil
+	test.HTTP(t, nil, Chain()(h).ServeHTTP)
+	if !reflect.DeepEqual(order, []string{"handler"}) {
+		t.Errorf("empty Chain\nout:  %v", order)
+	}
+}
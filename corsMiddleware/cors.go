@@ -32,9 +32,17 @@ const (
 // Config for the middleware.
 type Config struct {
 	// AllowOrigin defines a list of origins that may access the resource.
-	// Optional, with default value as []string{"*"}.
+	// Subdomains can be allowed with a wildcard, as in
+	// "https://*.example.com"; this doesn't match "https://example.com".
+	// Optional, with default value as []string{"*"}, unless AllowOriginFunc
+	// is set.
 	AllowOrigins []string
 
+	// AllowOriginFunc is called for origins that aren't in AllowOrigins; the
+	// origin is allowed if it returns true.
+	// Optional.
+	AllowOriginFunc func(origin string) bool
+
 	// AllowMethods defines a list methods allowed when accessing the resource.
 	// This is used in response to a preflight request.
 	// Optional, with default value as `DefaultConfig.AllowMethods`.
@@ -73,7 +81,7 @@ var DefaultConfig = Config{
 // Add the CORS middleware.
 func Add(config Config) func(http.Handler) http.Handler {
 
-	if len(config.AllowOrigins) == 0 {
+	if len(config.AllowOrigins) == 0 && config.AllowOriginFunc == nil {
 		config.AllowOrigins = DefaultConfig.AllowOrigins
 	}
 	if len(config.AllowMethods) == 0 {
@@ -90,14 +98,7 @@ func Add(config Config) func(http.Handler) http.Handler {
 
 			origin := r.Header.Get("Origin")
 
-			// Check allowed origins
-			allowedOrigin := ""
-			for _, o := range config.AllowOrigins {
-				if o == "*" || o == origin {
-					allowedOrigin = o
-					break
-				}
-			}
+			allowedOrigin := config.allowOrigin(origin)
 
 			// Simple request
 			if r.Method != http.MethodOptions {
@@ -146,3 +147,45 @@ func Add(config Config) func(http.Handler) http.Handler {
 		})
 	}
 }
+
+// allowOrigin gets the value for the Access-Control-Allow-Origin header, or
+// an empty string if the origin isn't allowed.
+func (config Config) allowOrigin(origin string) string {
+	if origin == "" {
+		return ""
+	}
+	for _, o := range config.AllowOrigins {
+		if o == "*" {
+			return o
+		}
+		if matchOrigin(o, origin) {
+			return origin
+		}
+	}
+	if config.AllowOriginFunc != nil && config.AllowOriginFunc(origin) {
+		return origin
+	}
+	return ""
+}
+
+// matchOrigin reports if origin matches pattern, which may contain a "*."
+// wildcard for subdomains.
+func matchOrigin(pattern, origin string) bool {
+	pattern = strings.ToLower(pattern)
+	origin = strings.ToLower(origin)
+
+	i := strings.Index(pattern, "*.")
+	if i == -1 {
+		return pattern == origin
+	}
+
+	prefix, suffix := pattern[:i], pattern[i+1:]
+	if len(origin) <= len(prefix)+len(suffix) ||
+		!strings.HasPrefix(origin, prefix) || !strings.HasSuffix(origin, suffix) {
+		return false
+	}
+
+	// Only allow a subdomain, and not e.g. "https://evil.com/.example.com".
+	sub := origin[len(prefix) : len(origin)-len(suffix)]
+	return !strings.ContainsAny(sub, "/:@?#")
+}
@@ -43,3 +43,91 @@ func TestDo(t *testing.T) {
 		})
 	}
 }
+
+func TestOrigin(t *testing.T) {
+	cases := []struct {
+		method     string
+		origin     string
+		config     Config
+		wantCode   int
+		wantOrigin string
+	}{
+		// Allowed.
+		{"GET", "https://example.com", DefaultConfig, 200, "*"},
+		{"GET", "https://example.com", Config{AllowOrigins: []string{"https://example.com"}},
+			200, "https://example.com"},
+		{"GET", "https://app.example.com", Config{AllowOrigins: []string{"https://*.example.com"}},
+			200, "https://app.example.com"},
+		{"GET", "https://a.B.example.com", Config{AllowOrigins: []string{"https://*.example.com"}},
+			200, "https://a.B.example.com"},
+		{"GET", "https://example.net", Config{
+			AllowOrigins:    []string{"https://example.com"},
+			AllowOriginFunc: func(o string) bool { return o == "https://example.net" },
+		}, 200, "https://example.net"},
+
+		// Disallowed.
+		{"GET", "https://evil.com", Config{AllowOrigins: []string{"https://example.com"}}, 200, ""},
+		{"GET", "https://example.com", Config{AllowOrigins: []string{"https://*.example.com"}}, 200, ""},
+		{"GET", "http://app.example.com", Config{AllowOrigins: []string{"https://*.example.com"}}, 200, ""},
+		{"GET", "https://app.example.com.evil.com", Config{AllowOrigins: []string{"https://*.example.com"}},
+			200, ""},
+		{"GET", "https://evil.com/.example.com", Config{AllowOrigins: []string{"https://*.example.com"}},
+			200, ""},
+		{"GET", "https://evil.com", Config{
+			AllowOriginFunc: func(o string) bool { return o == "https://example.net" },
+		}, 200, ""},
+		{"OPTIONS", "https://evil.com", Config{AllowOrigins: []string{"https://example.com"}}, 200, ""},
+
+		// Preflight.
+		{"OPTIONS", "https://app.example.com", Config{AllowOrigins: []string{"https://*.example.com"}},
+			204, "https://app.example.com"},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%v", i), func(t *testing.T) {
+			req := &http.Request{Method: tc.method, Header: http.Header{"Origin": {tc.origin}}}
+			rr := test.HTTP(t, req, Add(tc.config)(handle{}).ServeHTTP)
+
+			if rr.Code != tc.wantCode {
+				t.Errorf("code: %v; want: %v", rr.Code, tc.wantCode)
+			}
+			if o := rr.Header().Get(HeaderAccessControlAllowOrigin); o != tc.wantOrigin {
+				t.Errorf("origin: %q; want: %q", o, tc.wantOrigin)
+			}
+		})
+	}
+}
+
+func TestPreflight(t *testing.T) {
+	req := &http.Request{Method: "OPTIONS", Header: http.Header{
+		"Origin":                          {"https://example.com"},
+		HeaderAccessControlRequestMethod:  {"PUT"},
+		HeaderAccessControlRequestHeaders: {"X-Custom"},
+	}}
+	rr := test.HTTP(t, req, Add(Config{
+		AllowOrigins:     []string{"https://example.com"},
+		AllowMethods:     []string{"GET", "PUT"},
+		AllowCredentials: true,
+		MaxAge:           600,
+	})(handle{}).ServeHTTP)
+
+	if rr.Code != 204 {
+		t.Errorf("code: %v; want: 204", rr.Code)
+	}
+	if b := rr.Body.String(); b != "" {
+		t.Errorf("body: %q; want empty", b)
+	}
+
+	want := map[string]string{
+		HeaderAccessControlAllowOrigin:      "https://example.com",
+		HeaderAccessControlAllowMethods:     "GET,PUT",
+		HeaderAccessControlAllowHeaders:     "X-Custom",
+		HeaderAccessControlAllowCredentials: "true",
+		HeaderAccessControlMaxAge:           "600",
+	}
+	for k, v := range want {
+		if h := rr.Header().Get(k); h != v {
+			t.Errorf("%v: %q; want: %q", k, h, v)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+// Package csrfMiddleware protects against cross-site request forgery with a
+// double-submit cookie.
+//
+// A random token is set in a cookie, and requests with unsafe methods (POST,
+// PUT, PATCH, DELETE, etc.) need to send the same token in a header or form
+// field. Other sites can't read the cookie, so they can't send the token.
+//
+// Use Token() to get the token for a form or JavaScript.
+package csrfMiddleware // import "github.com/teamwork/middleware/csrfMiddleware"
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Config for the middleware.
+type Config struct {
+	// CookieName is the name of the token cookie; the default is
+	// "csrf_token".
+	CookieName string
+
+	// CookiePath is the path of the token cookie; the default is "/".
+	CookiePath string
+
+	// CookieDomain of the token cookie; the default is to not set it, which
+	// restricts it to the current host.
+	CookieDomain string
+
+	// MaxAge of the token cookie; the default is 12 hours.
+	MaxAge time.Duration
+
+	// JSReadable doesn't set HttpOnly on the cookie, so JavaScript can read
+	// the token to send it in the header.
+	JSReadable bool
+
+	// Insecure doesn't set Secure on the cookie, e.g. for development without
+	// HTTPS.
+	Insecure bool
+
+	// SameSite attribute of the cookie; the default is http.SameSiteLaxMode.
+	SameSite http.SameSite
+
+	// Header to read the token from; the default is "X-CSRF-Token".
+	Header string
+
+	// FormField to read the token from if the header isn't set; the default is
+	// "csrf_token".
+	FormField string
+
+	// Skipper skips the check if it returns true, e.g. for API endpoints that
+	// use bearer tokens instead of cookies.
+	Skipper func(*http.Request) bool
+
+	// ErrorHandler is called if the token is missing or doesn't match; the
+	// default is to send a 403 Forbidden.
+	ErrorHandler http.Handler
+}
+
+// DefaultConfig is the default CSRF middleware config.
+var DefaultConfig = Config{
+	CookieName: "csrf_token",
+	CookiePath: "/",
+	MaxAge:     12 * time.Hour,
+	SameSite:   http.SameSiteLaxMode,
+	Header:     "X-CSRF-Token",
+	FormField:  "csrf_token",
+}
+
+// tokenLength is the number of random bytes in a token.
+const tokenLength = 32
+
+type contextKey int
+
+const tokenKey contextKey = 0
+
+// Token gets the CSRF token for the request, to include in forms, or an empty
+// string if the middleware wasn't used.
+func Token(r *http.Request) string {
+	t, _ := r.Context().Value(tokenKey).(string)
+	return t
+}
+
+// Add the CSRF middleware with the DefaultConfig.
+func Add(next http.Handler) http.Handler {
+	return WithConfig(DefaultConfig)(next)
+}
+
+// WithConfig returns a CSRF middleware from config.
+func WithConfig(config Config) func(http.Handler) http.Handler {
+	if config.CookieName == "" {
+		config.CookieName = DefaultConfig.CookieName
+	}
+	if config.CookiePath == "" {
+		config.CookiePath = DefaultConfig.CookiePath
+	}
+	if config.MaxAge == 0 {
+		config.MaxAge = DefaultConfig.MaxAge
+	}
+	if config.SameSite == 0 {
+		config.SameSite = DefaultConfig.SameSite
+	}
+	if config.Header == "" {
+		config.Header = DefaultConfig.Header
+	}
+	if config.FormField == "" {
+		config.FormField = DefaultConfig.FormField
+	}
+	if config.ErrorHandler == nil {
+		config.ErrorHandler = http.HandlerFunc(forbidden)
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if config.Skipper != nil && config.Skipper(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			token := ""
+			if c, err := r.Cookie(config.CookieName); err == nil && validToken(c.Value) {
+				token = c.Value
+			}
+
+			if !isSafe(r.Method) {
+				sent := r.Header.Get(config.Header)
+				if sent == "" {
+					sent = r.PostFormValue(config.FormField)
+				}
+				if token == "" || subtle.ConstantTimeCompare([]byte(sent), []byte(token)) != 1 {
+					config.ErrorHandler.ServeHTTP(w, r)
+					return
+				}
+			}
+
+			if token == "" {
+				token = newToken()
+				http.SetCookie(w, &http.Cookie{
+					Name:     config.CookieName,
+					Value:    token,
+					Path:     config.CookiePath,
+					Domain:   config.CookieDomain,
+					MaxAge:   int(config.MaxAge / time.Second),
+					Secure:   !config.Insecure,
+					HttpOnly: !config.JSReadable,
+					SameSite: config.SameSite,
+				})
+			}
+
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), tokenKey, token)))
+		})
+	}
+}
+
+func forbidden(w http.ResponseWriter, r *http.Request) {
+	http.Error(w, "Forbidden: invalid CSRF token", http.StatusForbidden)
+}
+
+// isSafe reports if the method is safe, per RFC 7231 section 4.2.1.
+func isSafe(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
+
+// newToken generates a new random token.
+func newToken() string {
+	b := make([]byte, tokenLength)
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("csrfMiddleware: could not read random bytes: %v", err))
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// validToken reports if t looks like a token we generated.
+func validToken(t string) bool {
+	b, err := base64.RawURLEncoding.DecodeString(t)
+	return err == nil && len(b) == tokenLength
+}
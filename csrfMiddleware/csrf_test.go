@@ -0,0 +1,110 @@
+package csrfMiddleware
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/teamwork/test"
+)
+
+func TestIssue(t *testing.T) {
+	var token string
+	rr := test.HTTP(t, nil, Add(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token = Token(r)
+	})).ServeHTTP)
+
+	if rr.Code != 200 {
+		t.Errorf("code: %v", rr.Code)
+	}
+	if !validToken(token) {
+		t.Fatalf("invalid token: %q", token)
+	}
+
+	cookies := rr.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("%d cookies", len(cookies))
+	}
+	c := cookies[0]
+	if c.Name != "csrf_token" || c.Value != token || !c.HttpOnly || !c.Secure ||
+		c.SameSite != http.SameSiteLaxMode || c.Path != "/" {
+		t.Errorf("wrong cookie: %#v", c)
+	}
+
+	// Existing token is reused.
+	req := &http.Request{Method: "GET", Header: http.Header{
+		"Cookie": {"csrf_token=" + token},
+	}}
+	var token2 string
+	rr = test.HTTP(t, req, Add(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token2 = Token(r)
+	})).ServeHTTP)
+	if token2 != token {
+		t.Errorf("token not reused: %q", token2)
+	}
+	if len(rr.Result().Cookies()) != 0 {
+		t.Errorf("cookie set again")
+	}
+}
+
+func TestVerify(t *testing.T) {
+	token := newToken()
+	other := newToken()
+	form := "application/x-www-form-urlencoded"
+
+	cases := []struct {
+		name        string
+		method      string
+		cookie      string
+		header      string
+		contentType string
+		body        string
+		skip        bool
+		wantCode    int
+	}{
+		{"header", "POST", token, token, "", "", false, 200},
+		{"form", "POST", token, "", form, "csrf_token=" + url.QueryEscape(token), false, 200},
+		{"delete", "DELETE", token, token, "", "", false, 200},
+		{"safe", "GET", "", "", "", "", false, 200},
+		{"skipped", "POST", "", "", "", "", true, 200},
+
+		{"missing token", "POST", token, "", "", "", false, 403},
+		{"missing cookie", "POST", "", token, "", "", false, 403},
+		{"forged", "POST", token, other, "", "", false, 403},
+		{"forged form", "PUT", token, "", form, "csrf_token=" + url.QueryEscape(other), false, 403},
+		{"invalid cookie", "PATCH", "x", "x", "", "", false, 403},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest(tc.method, "/", strings.NewReader(tc.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tc.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: "csrf_token", Value: tc.cookie})
+			}
+			if tc.header != "" {
+				req.Header.Set("X-CSRF-Token", tc.header)
+			}
+			if tc.contentType != "" {
+				req.Header.Set("Content-Type", tc.contentType)
+			}
+
+			called := false
+			rr := test.HTTP(t, req, WithConfig(Config{
+				Skipper: func(*http.Request) bool { return tc.skip },
+			})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				called = true
+			})).ServeHTTP)
+
+			if rr.Code != tc.wantCode {
+				t.Errorf("code: %v; want: %v", rr.Code, tc.wantCode)
+			}
+			if called != (tc.wantCode == 200) {
+				t.Errorf("handler called: %t", called)
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+// Package gzipMiddleware compresses responses with gzip for clients that
+// accept it.
+package gzipMiddleware // import "github.com/teamwork/middleware/gzipMiddleware"
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Config for the middleware.
+type Config struct {
+	// Level is the gzip compression level; the default of 0 is
+	// gzip.DefaultCompression, rather than gzip.NoCompression.
+	Level int
+
+	// MinSize is the minimum response size in bytes to compress; smaller
+	// responses are sent uncompressed, as compressing them is of little use.
+	// Responses are always compressed once they're flushed.
+	MinSize int
+
+	// SkipContentTypes are Content-Type prefixes that are never compressed,
+	// because they're already compressed.
+	SkipContentTypes []string
+}
+
+// DefaultConfig is the default gzip middleware config.
+var DefaultConfig = Config{
+	Level:   gzip.DefaultCompression,
+	MinSize: 1024,
+	SkipContentTypes: []string{
+		"image/", "video/", "audio/", "font/woff",
+		"application/zip", "application/gzip", "application/x-gzip",
+		"application/x-bzip2", "application/x-7z-compressed",
+		"application/x-rar-compressed", "application/pdf",
+	},
+}
+
+// Add the gzip middleware with the DefaultConfig.
+func Add(next http.Handler) http.Handler {
+	return WithConfig(DefaultConfig)(next)
+}
+
+// WithConfig returns a gzip middleware from config.
+//
+// It will panic if the compression level is invalid.
+func WithConfig(config Config) func(http.Handler) http.Handler {
+	if config.Level == 0 {
+		config.Level = gzip.DefaultCompression
+	}
+	if config.SkipContentTypes == nil {
+		config.SkipContentTypes = DefaultConfig.SkipContentTypes
+	}
+	if _, err := gzip.NewWriterLevel(ioutil.Discard, config.Level); err != nil {
+		panic(fmt.Sprintf("gzipMiddleware: %v", err))
+	}
+
+	pool := &sync.Pool{New: func() interface{} {
+		gz, _ := gzip.NewWriterLevel(ioutil.Discard, config.Level)
+		return gz
+	}}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("Vary", "Accept-Encoding")
+			if !acceptsGzip(r) || r.Method == http.MethodHead {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// finish isn't deferred: if the handler panics the buffered
+			// response is discarded, so that rescueMiddleware can still send
+			// an error.
+			rw := &responseWriter{ResponseWriter: w, config: config, pool: pool}
+			next.ServeHTTP(rw, r)
+			rw.finish()
+		})
+	}
+}
+
+// acceptsGzip reports if the client accepts gzip-encoded responses.
+func acceptsGzip(r *http.Request) bool {
+	for _, enc := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		params := strings.Split(enc, ";")
+		name := strings.ToLower(strings.TrimSpace(params[0]))
+		if name != "gzip" && name != "*" {
+			continue
+		}
+
+		q := 1.0
+		for _, p := range params[1:] {
+			p = strings.TrimSpace(p)
+			if strings.HasPrefix(p, "q=") {
+				var err error
+				q, err = strconv.ParseFloat(p[2:], 64)
+				if err != nil {
+					q = 0
+				}
+			}
+		}
+		if q > 0 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,215 @@
+package gzipMiddleware
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/teamwork/middleware/rescueMiddleware"
+	"github.com/teamwork/test"
+)
+
+func TestGzip(t *testing.T) {
+	long := strings.Repeat("handler ", 200)
+	cases := []struct {
+		acceptEncoding string
+		contentType    string
+		body           string
+		wantGzip       bool
+	}{
+		{"gzip", "", long, true},
+		{"deflate, gzip;q=0.8", "text/plain", long, true},
+		{"*", "", long, true},
+		{"", "", long, false},
+		{"deflate", "", long, false},
+		{"gzip;q=0", "", long, false},
+		{"gzip", "image/png", long, false},
+		{"gzip", "", "handler", false},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%v", i), func(t *testing.T) {
+			req := &http.Request{Method: "GET", Header: http.Header{
+				"Accept-Encoding": {tc.acceptEncoding},
+			}}
+			rr := test.HTTP(t, req, Add(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tc.contentType != "" {
+					w.Header().Set("Content-Type", tc.contentType)
+				}
+				w.Header().Set("Content-Length", fmt.Sprintf("%d", len(tc.body)))
+				_, _ = w.Write([]byte(tc.body))
+			})).ServeHTTP)
+
+			if rr.Code != 200 {
+				t.Errorf("code: %v", rr.Code)
+			}
+			if v := rr.Header().Get("Vary"); v != "Accept-Encoding" {
+				t.Errorf("Vary: %q", v)
+			}
+
+			body := rr.Body.String()
+			if tc.wantGzip {
+				if e := rr.Header().Get("Content-Encoding"); e != "gzip" {
+					t.Fatalf("Content-Encoding: %q", e)
+				}
+				if l := rr.Header().Get("Content-Length"); l != "" {
+					t.Errorf("Content-Length not removed: %q", l)
+				}
+				body = gunzip(t, rr.Body.Bytes())
+			} else if e := rr.Header().Get("Content-Encoding"); e != "" {
+				t.Errorf("Content-Encoding: %q", e)
+			}
+			if body != tc.body {
+				t.Errorf("wrong body\nout:  %q\nwant: %q", body, tc.body)
+			}
+		})
+	}
+}
+
+func TestLevel(t *testing.T) {
+	body := strings.Repeat("handler ", 2000)
+	for _, config := range []Config{DefaultConfig, {MinSize: 1024}, {Level: gzip.BestSpeed}} {
+		t.Run(fmt.Sprintf("%v", config.Level), func(t *testing.T) {
+			req := &http.Request{Method: "GET", Header: http.Header{"Accept-Encoding": {"gzip"}}}
+			rr := test.HTTP(t, req, WithConfig(config)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				_, _ = w.Write([]byte(body))
+			})).ServeHTTP)
+
+			if e := rr.Header().Get("Content-Encoding"); e != "gzip" {
+				t.Fatalf("Content-Encoding: %q", e)
+			}
+			if l := rr.Body.Len(); l >= len(body)/10 {
+				t.Errorf("not compressed: %d bytes", l)
+			}
+			if b := gunzip(t, rr.Body.Bytes()); b != body {
+				t.Errorf("wrong body")
+			}
+		})
+	}
+}
+
+func TestFlush(t *testing.T) {
+	rr := httptest.NewRecorder()
+	req := &http.Request{Method: "GET", Header: http.Header{"Accept-Encoding": {"gzip"}}}
+
+	var flushed string
+	Add(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = w.Write([]byte("event 1\n"))
+		w.(http.Flusher).Flush()
+		flushed = gunzip(t, rr.Body.Bytes())
+		_, _ = w.Write([]byte("event 2\n"))
+	})).ServeHTTP(rr, req)
+
+	if !rr.Flushed {
+		t.Error("not flushed")
+	}
+	if flushed != "event 1\n" {
+		t.Errorf("wrong flushed body: %q", flushed)
+	}
+	if b := gunzip(t, rr.Body.Bytes()); b != "event 1\nevent 2\n" {
+		t.Errorf("wrong body: %q", b)
+	}
+}
+
+func TestStatus(t *testing.T) {
+	req := &http.Request{Method: "GET", Header: http.Header{"Accept-Encoding": {"gzip"}}}
+	rr := test.HTTP(t, req, Add(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})).ServeHTTP)
+
+	if rr.Code != http.StatusNoContent {
+		t.Errorf("code: %v", rr.Code)
+	}
+	if e := rr.Header().Get("Content-Encoding"); e != "" {
+		t.Errorf("Content-Encoding: %q", e)
+	}
+}
+
+func TestPanic(t *testing.T) {
+	req := &http.Request{Method: "GET", Header: http.Header{"Accept-Encoding": {"gzip"}}}
+	rr := test.HTTP(t, req, rescueMiddleware.WithConfig(rescueMiddleware.Config{
+		Log:       func(*http.Request, error) {},
+		RequestID: func(*http.Request) string { return "abc" },
+	})(Add(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("partial"))
+		panic("oh noes")
+	}))).ServeHTTP)
+
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("code: %v", rr.Code)
+	}
+	if e := rr.Header().Get("Content-Encoding"); e != "" {
+		t.Errorf("Content-Encoding: %q", e)
+	}
+	want := "Sorry, the server ran into a problem processing this request.\n\nRequest ID: abc"
+	if b := rr.Body.String(); b != want {
+		t.Errorf("wrong body\nout:  %q\nwant: %q", b, want)
+	}
+}
+
+type hijackRecorder struct {
+	*httptest.ResponseRecorder
+	conn net.Conn
+}
+
+func (h hijackRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return h.conn, nil, nil
+}
+
+func TestHijack(t *testing.T) {
+	server, client := net.Pipe()
+	defer server.Close() // nolint: errcheck
+	defer client.Close() // nolint: errcheck
+
+	rr := hijackRecorder{httptest.NewRecorder(), server}
+	req := &http.Request{Method: "GET", Header: http.Header{"Accept-Encoding": {"gzip"}}}
+
+	var (
+		conn net.Conn
+		err  error
+	)
+	Add(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		conn, _, err = w.(http.Hijacker).Hijack()
+	})).ServeHTTP(rr, req)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conn != server {
+		t.Errorf("wrong conn: %v", conn)
+	}
+	if rr.Body.Len() != 0 || rr.Header().Get("Content-Encoding") != "" {
+		t.Errorf("written after hijack: %q %v", rr.Body.String(), rr.Header())
+	}
+
+	// Not a Hijacker.
+	Add(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _, err = w.(http.Hijacker).Hijack()
+	})).ServeHTTP(httptest.NewRecorder(), req)
+	if err == nil {
+		t.Error("no error for ResponseRecorder")
+	}
+}
+
+// gunzip reads the gzip data in b, which may be incomplete.
+func gunzip(t *testing.T, b []byte) string {
+	t.Helper()
+	gz, err := gzip.NewReader(strings.NewReader(string(b)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := ioutil.ReadAll(gz)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		t.Fatal(err)
+	}
+	return string(out)
+}
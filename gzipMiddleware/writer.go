@@ -0,0 +1,153 @@
+package gzipMiddleware
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// responseWriter buffers the response until it's known if it should be
+// compressed, and then writes it through a gzip.Writer or as-is.
+type responseWriter struct {
+	http.ResponseWriter
+	config Config
+	pool   *sync.Pool
+
+	status   int
+	buf      []byte
+	decided  bool
+	gz       *gzip.Writer
+	hijacked bool
+}
+
+func (w *responseWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+}
+
+func (w *responseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+
+	if !w.decided {
+		w.buf = append(w.buf, b...)
+		if len(w.buf) >= w.config.MinSize {
+			if err := w.decide(w.compressible()); err != nil {
+				return 0, err
+			}
+		}
+		return len(b), nil
+	}
+
+	if w.gz != nil {
+		return w.gz.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush implements http.Flusher.
+func (w *responseWriter) Flush() {
+	if !w.decided {
+		if w.status == 0 {
+			w.status = http.StatusOK
+		}
+		// Streaming responses are always compressed, as we don't know how
+		// large they'll be.
+		w.decide(w.compressible()) // nolint: errcheck
+	}
+	if w.gz != nil {
+		w.gz.Flush() // nolint: errcheck
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack implements http.Hijacker.
+func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("gzipMiddleware: %T is not a http.Hijacker", w.ResponseWriter)
+	}
+	w.hijacked = true
+	return h.Hijack()
+}
+
+// compressible reports if the response can be compressed, based on the status
+// code and headers set by the handler.
+func (w *responseWriter) compressible() bool {
+	if w.status < 200 || w.status == http.StatusNoContent ||
+		w.status == http.StatusNotModified {
+		return false
+	}
+
+	h := w.Header()
+	if h.Get("Content-Encoding") != "" {
+		return false
+	}
+	if h.Get("Content-Type") == "" && len(w.buf) > 0 {
+		// Detect it now, as net/http would detect it from the compressed
+		// data.
+		h.Set("Content-Type", http.DetectContentType(w.buf))
+	}
+
+	ct := strings.ToLower(h.Get("Content-Type"))
+	for _, skip := range w.config.SkipContentTypes {
+		if strings.HasPrefix(ct, skip) {
+			return false
+		}
+	}
+	return true
+}
+
+// decide writes the headers and the buffered data, compressing it if compress
+// is true.
+func (w *responseWriter) decide(compress bool) error {
+	w.decided = true
+	if compress {
+		h := w.Header()
+		h.Del("Content-Length")
+		h.Set("Content-Encoding", "gzip")
+		w.gz = w.pool.Get().(*gzip.Writer)
+		w.gz.Reset(w.ResponseWriter)
+	}
+
+	w.ResponseWriter.WriteHeader(w.status)
+	if len(w.buf) == 0 {
+		return nil
+	}
+
+	var err error
+	if w.gz != nil {
+		_, err = w.gz.Write(w.buf)
+	} else {
+		_, err = w.ResponseWriter.Write(w.buf)
+	}
+	w.buf = nil
+	return err
+}
+
+// finish writes any buffered data uncompressed, or closes the gzip.Writer.
+func (w *responseWriter) finish() {
+	if w.hijacked {
+		return
+	}
+	if !w.decided {
+		if w.status == 0 {
+			return
+		}
+		w.decide(false) // nolint: errcheck
+		return
+	}
+	if w.gz != nil {
+		w.gz.Close() // nolint: errcheck
+		w.pool.Put(w.gz)
+		w.gz = nil
+	}
+}
@@ -0,0 +1,85 @@
+// Package healthCheckMiddleware responds to health check requests, such as
+// Kubernetes liveness probes, without calling any other handlers.
+//
+// Add it as the outermost middleware, so the probes skip logging, security
+// headers, etc.
+package healthCheckMiddleware // import "github.com/teamwork/middleware/healthCheckMiddleware"
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// Config for the middleware.
+type Config struct {
+	// Paths to respond to; the default is /healthz.
+	Paths []string
+
+	// Check the application's health; a 503 Service Unavailable is sent if it
+	// returns an error. The response is JSON if this is set.
+	// Optional.
+	Check func() error
+
+	// IncludeError adds the error from Check to the response as "error". The
+	// health check endpoint is usually public, so only enable this if the
+	// errors don't contain anything sensitive.
+	IncludeError bool
+}
+
+// DefaultConfig is the default health check middleware config.
+var DefaultConfig = Config{
+	Paths: []string{"/healthz"},
+}
+
+// Add the health check middleware with the DefaultConfig.
+func Add(next http.Handler) http.Handler {
+	return WithConfig(DefaultConfig)(next)
+}
+
+// WithConfig returns a health check middleware from config.
+func WithConfig(config Config) func(http.Handler) http.Handler {
+	if len(config.Paths) == 0 {
+		config.Paths = DefaultConfig.Paths
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL == nil || !inSlice(config.Paths, r.URL.Path) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Set("Cache-Control", "no-store")
+			if config.Check == nil {
+				w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+				w.WriteHeader(http.StatusOK)
+				_, _ = w.Write([]byte("OK"))
+				return
+			}
+
+			status := http.StatusOK
+			body := map[string]string{"status": "ok"}
+			if err := config.Check(); err != nil {
+				status = http.StatusServiceUnavailable
+				body = map[string]string{"status": "error"}
+				if config.IncludeError {
+					body["error"] = err.Error()
+				}
+			}
+
+			b, _ := json.Marshal(body)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(status)
+			_, _ = w.Write(b)
+		})
+	}
+}
+
+func inSlice(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,51 @@
+package healthCheckMiddleware
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/teamwork/test"
+)
+
+type handle struct{}
+
+func (h handle) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	_, _ = w.Write([]byte("handler"))
+}
+
+func TestHealthCheck(t *testing.T) {
+	cases := []struct {
+		config   Config
+		path     string
+		wantCode int
+		wantBody string
+	}{
+		{DefaultConfig, "/healthz", 200, "OK"},
+		{DefaultConfig, "/", 200, "handler"},
+		{DefaultConfig, "/healthz/x", 200, "handler"},
+		{Config{Paths: []string{"/ping", "/ready"}}, "/ready", 200, "OK"},
+		{Config{Check: func() error { return nil }}, "/healthz", 200, `{"status":"ok"}`},
+		{Config{Check: func() error { return errors.New("db down") }}, "/healthz",
+			503, `{"status":"error"}`},
+		{Config{Check: func() error { return errors.New("db down") }, IncludeError: true}, "/healthz",
+			503, `{"error":"db down","status":"error"}`},
+		{Config{Check: func() error { return errors.New("db down") }}, "/", 200, "handler"},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%v", i), func(t *testing.T) {
+			req := &http.Request{Method: "GET", URL: &url.URL{Path: tc.path}}
+			rr := test.HTTP(t, req, WithConfig(tc.config)(handle{}).ServeHTTP)
+
+			if rr.Code != tc.wantCode {
+				t.Errorf("code: %v; want: %v", rr.Code, tc.wantCode)
+			}
+			if b := rr.Body.String(); b != tc.wantBody {
+				t.Errorf("body: %q; want: %q", b, tc.wantBody)
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+// Package methodOverrideMiddleware allows clients that can only send GET and
+// POST requests, such as HTML forms, to use other methods.
+package methodOverrideMiddleware // import "github.com/teamwork/middleware/methodOverrideMiddleware"
+
+import (
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// Config for the middleware.
+type Config struct {
+	// Header to read the method from; this takes precedence over FormField.
+	// Leave empty to not use a header.
+	Header string
+
+	// FormField to read the method from, for form-encoded request bodies.
+	// Leave empty to not use a form field.
+	FormField string
+
+	// Methods that can be used as an override; the default is PUT, PATCH, and
+	// DELETE.
+	Methods []string
+}
+
+// DefaultConfig is the default method override middleware config.
+var DefaultConfig = Config{
+	Header:    "X-HTTP-Method-Override",
+	FormField: "_method",
+	Methods:   []string{http.MethodPut, http.MethodPatch, http.MethodDelete},
+}
+
+// Add the method override middleware with the DefaultConfig.
+func Add(next http.Handler) http.Handler {
+	return WithConfig(DefaultConfig)(next)
+}
+
+// WithConfig returns a method override middleware from config.
+//
+// Only POST requests are changed; the request is left as a POST if the
+// override isn't one of the allowed Methods.
+func WithConfig(config Config) func(http.Handler) http.Handler {
+	if len(config.Methods) == 0 {
+		config.Methods = DefaultConfig.Methods
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPost {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			m := ""
+			if config.Header != "" {
+				m = r.Header.Get(config.Header)
+			}
+			if m == "" && config.FormField != "" && isForm(r) {
+				m = r.PostFormValue(config.FormField)
+			}
+
+			m = strings.ToUpper(strings.TrimSpace(m))
+			for _, allowed := range config.Methods {
+				if m == allowed {
+					r = r.WithContext(r.Context())
+					r.Method = m
+					break
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// isForm reports if the request has a form-encoded body.
+func isForm(r *http.Request) bool {
+	ct, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+	return ct == "application/x-www-form-urlencoded" || ct == "multipart/form-data"
+}
@@ -0,0 +1,65 @@
+package methodOverrideMiddleware
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/teamwork/test"
+)
+
+func TestMethodOverride(t *testing.T) {
+	form := "application/x-www-form-urlencoded"
+	cases := []struct {
+		method      string
+		header      string
+		contentType string
+		body        string
+		want        string
+	}{
+		// Header.
+		{"POST", "PUT", "", "", "PUT"},
+		{"POST", "delete", "", "", "DELETE"},
+		{"POST", "PATCH", form, "_method=DELETE", "PATCH"},
+
+		// Form.
+		{"POST", "", form, "_method=DELETE", "DELETE"},
+		{"POST", "", form, "a=b&_method=put", "PUT"},
+		{"POST", "", "text/plain", "_method=DELETE", "POST"},
+
+		// Invalid.
+		{"POST", "GET", "", "", "POST"},
+		{"POST", "CONNECT", "", "", "POST"},
+		{"POST", "", form, "_method=TRACE", "POST"},
+		{"POST", "", "", "", "POST"},
+
+		// Not a POST.
+		{"GET", "DELETE", "", "", "GET"},
+		{"PUT", "DELETE", "", "", "PUT"},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%v", i), func(t *testing.T) {
+			req, err := http.NewRequest(tc.method, "/", strings.NewReader(tc.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tc.header != "" {
+				req.Header.Set("X-HTTP-Method-Override", tc.header)
+			}
+			if tc.contentType != "" {
+				req.Header.Set("Content-Type", tc.contentType)
+			}
+
+			var method string
+			test.HTTP(t, req, Add(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				method = r.Method
+			})).ServeHTTP)
+
+			if method != tc.want {
+				t.Errorf("method: %q; want: %q", method, tc.want)
+			}
+		})
+	}
+}
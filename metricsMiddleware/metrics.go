@@ -0,0 +1,185 @@
+// Package metricsMiddleware records Prometheus metrics for HTTP requests.
+//
+// The metrics are:
+//
+//	http_requests_total{method, route, code}        Counter
+//	http_request_duration_seconds{method, route}    Histogram
+//	http_requests_in_flight{method, route}          Gauge
+package metricsMiddleware // import "github.com/teamwork/middleware/metricsMiddleware"
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Config for the middleware.
+type Config struct {
+	// Registerer to register the collectors on; the default is
+	// prometheus.DefaultRegisterer.
+	Registerer prometheus.Registerer
+
+	// Namespace to prefix the metric names with.
+	// Optional.
+	Namespace string
+
+	// Route gets the route pattern for the request, such as "/users/:id",
+	// which is used as a label. It should return the pattern from the router
+	// in use, as raw paths would result in too many label values.
+	//
+	// The default is "other" for all requests. PathRoute can be used if the
+	// paths are already limited, e.g. because unknown paths are rejected
+	// before this middleware.
+	Route func(*http.Request) string
+
+	// Buckets for the duration histogram; the default is
+	// prometheus.DefBuckets.
+	Buckets []float64
+}
+
+// Helper function to make it easier to test.
+var now = func() time.Time { return time.Now() }
+
+// WithConfig returns a metrics middleware from config.
+//
+// It will panic if the collectors can't be registered, e.g. because they're
+// already registered; use New() to get an error instead.
+func WithConfig(config Config) func(http.Handler) http.Handler {
+	mw, err := New(config)
+	if err != nil {
+		panic(err)
+	}
+	return mw
+}
+
+// New returns a metrics middleware from config, or an error if the collectors
+// can't be registered.
+func New(config Config) (func(http.Handler) http.Handler, error) {
+	if config.Registerer == nil {
+		config.Registerer = prometheus.DefaultRegisterer
+	}
+	if config.Route == nil {
+		config.Route = func(*http.Request) string { return "other" }
+	}
+	if config.Buckets == nil {
+		config.Buckets = prometheus.DefBuckets
+	}
+
+	requests := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: config.Namespace,
+		Name:      "http_requests_total",
+		Help:      "Number of HTTP requests.",
+	}, []string{"method", "route", "code"})
+	duration := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: config.Namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Duration of HTTP requests.",
+		Buckets:   config.Buckets,
+	}, []string{"method", "route"})
+	inFlight := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: config.Namespace,
+		Name:      "http_requests_in_flight",
+		Help:      "Number of HTTP requests being served.",
+	}, []string{"method", "route"})
+
+	for _, c := range []prometheus.Collector{requests, duration, inFlight} {
+		if err := config.Registerer.Register(c); err != nil {
+			return nil, errors.Wrap(err, "metricsMiddleware: could not register collector")
+		}
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			method := normalizeMethod(r.Method)
+			route := config.Route(r)
+
+			inFlight.WithLabelValues(method, route).Inc()
+			start := now()
+			rw := &responseWriter{ResponseWriter: w}
+			done := false
+			defer func() {
+				inFlight.WithLabelValues(method, route).Dec()
+				duration.WithLabelValues(method, route).Observe(now().Sub(start).Seconds())
+
+				code := rw.status
+				switch {
+				// The handler panic()ed; this will be a 500 if rescueMiddleware
+				// is added before this middleware. The panic isn't recovered
+				// to keep the stack trace intact.
+				case !done && code == 0:
+					code = http.StatusInternalServerError
+				case code == 0:
+					code = http.StatusOK
+				}
+				requests.WithLabelValues(method, route, strconv.Itoa(code)).Inc()
+			}()
+
+			next.ServeHTTP(rw, r)
+			done = true
+		})
+	}, nil
+}
+
+// PathRoute gets the request path with all segments that are numbers or UUIDs
+// replaced with ":id".
+//
+// Other segments are used as-is, so clients can still create any number of
+// label values by requesting made-up paths.
+func PathRoute(r *http.Request) string {
+	if r.URL == nil {
+		return ""
+	}
+
+	segments := strings.Split(r.URL.Path, "/")
+	for i, s := range segments {
+		if isID(s) {
+			segments[i] = ":id"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// isID reports if s is a number or UUID.
+func isID(s string) bool {
+	if s == "" {
+		return false
+	}
+	if _, err := strconv.ParseUint(s, 10, 64); err == nil {
+		return true
+	}
+	if len(s) != 36 {
+		return false
+	}
+	for i, c := range s {
+		switch {
+		case i == 8 || i == 13 || i == 18 || i == 23:
+			if c != '-' {
+				return false
+			}
+		case (c < '0' || c > '9') && (c < 'a' || c > 'f') && (c < 'A' || c > 'F'):
+			return false
+		}
+	}
+	return true
+}
+
+// knownMethods are used as-is for the method label; all other methods are
+// recorded as "OTHER" so clients can't create arbitrary label values.
+var knownMethods = []string{
+	http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+	http.MethodPatch, http.MethodDelete, http.MethodConnect,
+	http.MethodOptions, http.MethodTrace,
+}
+
+func normalizeMethod(m string) string {
+	for _, k := range knownMethods {
+		if m == k {
+			return m
+		}
+	}
+	return "OTHER"
+}
@@ -0,0 +1,200 @@
+package metricsMiddleware
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/teamwork/test"
+)
+
+type handle struct{}
+
+func (h handle) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	_, _ = w.Write([]byte("handler"))
+}
+
+func TestMetrics(t *testing.T) {
+	start := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	calls := 0
+	oldNow := now
+	now = func() time.Time {
+		calls++
+		return start.Add(time.Duration(calls-1) * 100 * time.Millisecond)
+	}
+	defer func() { now = oldNow }()
+
+	reg := prometheus.NewRegistry()
+	mw := WithConfig(Config{Registerer: reg, Namespace: "test", Route: PathRoute})
+
+	notFound := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	for _, tc := range []struct {
+		method, path string
+		handler      http.Handler
+	}{
+		{"GET", "/users/1", handle{}},
+		{"GET", "/users/2", handle{}},
+		{"POST", "/users", handle{}},
+		{"GET", "/users/3", notFound},
+		{"FOO", "/users", handle{}},
+	} {
+		req := &http.Request{Method: tc.method, URL: &url.URL{Path: tc.path}}
+		test.HTTP(t, req, mw(tc.handler).ServeHTTP)
+	}
+
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	metrics := make(map[string]*dto.MetricFamily)
+	for _, mf := range mfs {
+		metrics[mf.GetName()] = mf
+	}
+
+	wantCounts := map[string]float64{
+		"GET /users/:id 200": 2,
+		"POST /users 200":    1,
+		"GET /users/:id 404": 1,
+		"OTHER /users 200":   1,
+	}
+	counts := make(map[string]float64)
+	for _, m := range metrics["test_http_requests_total"].GetMetric() {
+		counts[labels(m, "method", "route", "code")] = m.GetCounter().GetValue()
+	}
+	if fmt.Sprint(counts) != fmt.Sprint(wantCounts) {
+		t.Errorf("wrong counts\nout:  %v\nwant: %v", counts, wantCounts)
+	}
+
+	for _, m := range metrics["test_http_request_duration_seconds"].GetMetric() {
+		if labels(m, "method", "route") != "GET /users/:id" {
+			continue
+		}
+		h := m.GetHistogram()
+		if h.GetSampleCount() != 3 || fmt.Sprintf("%.1f", h.GetSampleSum()) != "0.3" {
+			t.Errorf("wrong histogram: %v", h)
+		}
+	}
+
+	for _, m := range metrics["test_http_requests_in_flight"].GetMetric() {
+		if v := m.GetGauge().GetValue(); v != 0 {
+			t.Errorf("in flight for %v: %v", labels(m, "method", "route"), v)
+		}
+	}
+}
+
+func TestInFlight(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	var inFlight float64
+	test.HTTP(t, &http.Request{Method: "GET", URL: &url.URL{Path: "/"}}, WithConfig(Config{
+		Registerer: reg,
+		Route:      func(*http.Request) string { return "root" },
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mfs, _ := reg.Gather()
+		for _, mf := range mfs {
+			if mf.GetName() == "http_requests_in_flight" {
+				inFlight = mf.GetMetric()[0].GetGauge().GetValue()
+			}
+		}
+	})).ServeHTTP)
+
+	if inFlight != 1 {
+		t.Errorf("in flight: %v; want: 1", inFlight)
+	}
+}
+
+func TestPanic(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	mw := WithConfig(Config{Registerer: reg})
+
+	func() {
+		defer func() { _ = recover() }()
+		test.HTTP(t, &http.Request{Method: "GET", URL: &url.URL{Path: "/"}},
+			mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				panic("oh noes")
+			})).ServeHTTP)
+	}()
+
+	mfs, _ := reg.Gather()
+	for _, mf := range mfs {
+		if mf.GetName() != "http_requests_total" {
+			continue
+		}
+		if l := labels(mf.GetMetric()[0], "code"); l != "500" {
+			t.Errorf("code: %v; want: 500", l)
+		}
+	}
+}
+
+func TestNew(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	if _, err := New(Config{Registerer: reg}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := New(Config{Registerer: reg}); err == nil {
+		t.Error("no error when registering twice")
+	}
+}
+
+func TestDefaultRoute(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	mw := WithConfig(Config{Registerer: reg})
+	for _, p := range []string{"/", "/users/1", "/made-up"} {
+		test.HTTP(t, &http.Request{Method: "GET", URL: &url.URL{Path: p}}, mw(handle{}).ServeHTTP)
+	}
+
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, mf := range mfs {
+		if mf.GetName() != "http_requests_total" {
+			continue
+		}
+		if len(mf.GetMetric()) != 1 {
+			t.Fatalf("want one series, got %v", mf.GetMetric())
+		}
+		m := mf.GetMetric()[0]
+		if l := labels(m, "route"); l != "other" || m.GetCounter().GetValue() != 3 {
+			t.Errorf("route: %v; count: %v", l, m.GetCounter().GetValue())
+		}
+	}
+}
+
+func TestPathRoute(t *testing.T) {
+	cases := map[string]string{
+		"":          "",
+		"/":         "/",
+		"/users":    "/users",
+		"/users/42": "/users/:id",
+		"/users/42/posts/d9a1e0a8-7e03-4ba5-9c4b-0c8a0b4c2c3e": "/users/:id/posts/:id",
+		"/v2/users": "/v2/users",
+	}
+	for in, want := range cases {
+		got := PathRoute(&http.Request{URL: &url.URL{Path: in}})
+		if got != want {
+			t.Errorf("PathRoute(%q) = %q; want: %q", in, got, want)
+		}
+	}
+}
+
+// labels gets the values of the named labels, separated by spaces.
+func labels(m *dto.Metric, names ...string) string {
+	values := make(map[string]string)
+	for _, l := range m.GetLabel() {
+		values[l.GetName()] = l.GetValue()
+	}
+	s := ""
+	for i, n := range names {
+		if i > 0 {
+			s += " "
+		}
+		s += values[n]
+	}
+	return s
+}
@@ -1,5 +1,8 @@
 // Package ratelimitMiddleware implements rate limiting of HTTP requests.
 // The default rate is 20 requests per minute. This rate can be changed using SetRate.
+//
+// Requests are tracked in Redis by default; use Config.Store to use a
+// different store, such as the in-memory token bucket in NewMemoryStore.
 package ratelimitMiddleware // import "github.com/teamwork/middleware/ratelimitMiddleware"
 
 import (
@@ -33,11 +36,18 @@ type redisPool interface {
 
 // Config for RateLimit
 type Config struct {
-	Pool       redisPool
+	// Pool is the Redis pool to use if Store is nil.
+	Pool redisPool
+
+	// Store to keep track of requests in; the default is to use Redis from
+	// Pool.
+	Store Store
+
 	GrantOnErr bool
 	ErrorLog   func(error, string)
 
-	// GetKey generates bucket keys.
+	// GetKey generates bucket keys; the default is IPBucket("ratelimit"), and
+	// KeyBucket or HeaderBucket can be used to key by e.g. a user.
 	GetKey func(*http.Request) string
 
 	// Ignore rate limit verification for this request if this returns true.
@@ -67,13 +77,42 @@ func IPBucket(prefix string) func(*http.Request) string {
 	}
 }
 
+// HeaderBucket is a generator of rate limit buckets based on a request header,
+// such as a user ID set by an authentication middleware. If the header is empty
+// the client's IP address is used.
+//
+// The header must be set (or removed) by trusted code before the rate limiter
+// runs: clients can send any header, and would otherwise get a new bucket for
+// every value they make up. Use KeyBucket to get the key from the request
+// context instead.
+func HeaderBucket(prefix, header string) func(*http.Request) string {
+	return KeyBucket(prefix, func(req *http.Request) string {
+		return req.Header.Get(header)
+	})
+}
+
+// KeyBucket is a generator of rate limit buckets based on the key returned by
+// key, for example a user ID an authentication middleware stored in the request
+// context. If key returns an empty string the client's IP address is used.
+func KeyBucket(prefix string, key func(*http.Request) string) func(*http.Request) string {
+	return func(req *http.Request) string {
+		if v := key(req); v != "" {
+			return fmt.Sprintf("%s-%s", prefix, v)
+		}
+		return fmt.Sprintf("%s-%s", prefix, realip.RealIP(req))
+	}
+}
+
 // RateLimit limits requests for a key provided by getKey function.
 // If ignore function returns true, rate limit is bypassed.
 // grantOnErr argument defines if it should grant access when Redis is down.
+//
+// A 429 Too Many Requests response with a Retry-After header is sent if the
+// limit is exceeded.
 func RateLimit(opts Config) func(http.Handler) http.Handler {
 
 	if opts.GetKey == nil {
-		panic("opts.GetKey is nil")
+		opts.GetKey = IPBucket("ratelimit")
 	}
 
 	if opts.ErrorLog == nil {
@@ -95,8 +134,22 @@ func RateLimit(opts Config) func(http.Handler) http.Handler {
 				perPeriodLocal, periodSecondsLocal = opts.Rates(r)
 			}
 
-			key := opts.GetKey(r)
-			granted, remaining, err := grant(&opts, key, perPeriodLocal, periodSecondsLocal)
+			var (
+				key        = opts.GetKey(r)
+				period     = time.Duration(periodSecondsLocal) * time.Second
+				granted    bool
+				remaining  int
+				retryAfter time.Duration
+				err        error
+			)
+			if opts.Store != nil {
+				granted, remaining, retryAfter, err = opts.Store.Take(key, perPeriodLocal, period)
+			} else {
+				// The sliding window in Redis doesn't track when the oldest
+				// request expires.
+				granted, remaining, err = grant(&opts, key, perPeriodLocal, periodSecondsLocal)
+				retryAfter = period
+			}
 			if err != nil {
 				opts.ErrorLog(err, "failed to check if access is granted")
 				// returns an extra header when redis is down
@@ -109,6 +162,7 @@ func RateLimit(opts Config) func(http.Handler) http.Handler {
 			w.Header().Add("X-Rate-Limit-Reset", strconv.Itoa(periodSecondsLocal))
 
 			if !granted {
+				w.Header().Set("Retry-After", strconv.Itoa(retrySeconds(retryAfter)))
 				w.WriteHeader(http.StatusTooManyRequests)
 				return
 			}
@@ -118,6 +172,16 @@ func RateLimit(opts Config) func(http.Handler) http.Handler {
 	}
 }
 
+// retrySeconds gets the value for the Retry-After header, rounding up to at
+// least one second.
+func retrySeconds(d time.Duration) int {
+	s := int((d + time.Second - 1) / time.Second)
+	if s < 1 {
+		s = 1
+	}
+	return s
+}
+
 // grant checks if the access is granted for this bucket key.
 var grant = func(opts *Config, key string, perPeriod, periodSeconds int) (granted bool, remaining int, err error) {
 	accessTime := now().UnixNano()
@@ -1,6 +1,7 @@
 package ratelimitMiddleware
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"testing"
@@ -254,3 +255,25 @@ func TestGrant(t *testing.T) {
 		})
 	}
 }
+
+func TestKeyBucket(t *testing.T) {
+	type userKey struct{}
+	getKey := KeyBucket("ratelimit", func(r *http.Request) string {
+		id, _ := r.Context().Value(userKey{}).(string)
+		return id
+	})
+
+	req, err := http.NewRequest("GET", "/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.RemoteAddr = "10.0.0.1:1234"
+	if k, want := getKey(req), IPBucket("ratelimit")(req); k != want {
+		t.Errorf("wrong key without user: %#v; want %#v", k, want)
+	}
+
+	req = req.WithContext(context.WithValue(req.Context(), userKey{}, "42"))
+	if k := getKey(req); k != "ratelimit-42" {
+		t.Errorf("wrong key with user: %#v", k)
+	}
+}
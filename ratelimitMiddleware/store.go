@@ -0,0 +1,98 @@
+package ratelimitMiddleware
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Store keeps track of requests per bucket key.
+type Store interface {
+	// Take a request from the bucket for key, where limit requests are
+	// allowed per period.
+	//
+	// It returns if the request is granted, the number of requests remaining,
+	// and how long until the next request would be granted.
+	Take(key string, limit int, period time.Duration) (granted bool, remaining int, retryAfter time.Duration, err error)
+}
+
+// evictEvery is how often the MemoryStore removes idle buckets.
+const evictEvery = time.Minute
+
+// MemoryStore is an in-memory token bucket Store. It's safe for concurrent
+// use, but limits are per process.
+//
+// Every bucket holds up to limit tokens, which are refilled at a rate of limit
+// per period. Buckets that are full are removed periodically, so memory use is
+// bounded by the number of keys seen per period.
+//
+// The zero value is an empty store ready to use.
+type MemoryStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastEvict time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	period time.Duration
+}
+
+// NewMemoryStore creates a new empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		buckets:   make(map[string]*bucket),
+		lastEvict: now(),
+	}
+}
+
+// Take a request from the bucket for key.
+func (s *MemoryStore) Take(key string, limit int, period time.Duration) (bool, int, time.Duration, error) {
+	if limit < 1 || period <= 0 {
+		return false, 0, period, ErrInvalidRate
+	}
+
+	t := now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.buckets == nil {
+		s.buckets = make(map[string]*bucket)
+		s.lastEvict = t
+	}
+	if t.Sub(s.lastEvict) >= evictEvery {
+		s.evict(t)
+	}
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limit), last: t}
+		s.buckets[key] = b
+	}
+	b.period = period
+
+	rate := float64(limit) / float64(period)
+	b.tokens += float64(t.Sub(b.last)) * rate
+	if b.tokens > float64(limit) {
+		b.tokens = float64(limit)
+	}
+	b.last = t
+
+	if b.tokens < 1 {
+		return false, 0, time.Duration(math.Ceil((1 - b.tokens) / rate)), nil
+	}
+	b.tokens--
+	return true, int(b.tokens), 0, nil
+}
+
+// evict removes buckets that have been idle for long enough to be full again;
+// these are the same as a new bucket.
+func (s *MemoryStore) evict(t time.Time) {
+	for k, b := range s.buckets {
+		if t.Sub(b.last) >= b.period {
+			delete(s.buckets, k)
+		}
+	}
+	s.lastEvict = t
+}
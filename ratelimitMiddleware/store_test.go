@@ -0,0 +1,122 @@
+package ratelimitMiddleware
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/teamwork/test"
+)
+
+func TestMemoryStore(t *testing.T) {
+	start := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	cur := start
+	oldNow := now
+	now = func() time.Time { return cur }
+	defer func() { now = oldNow }()
+
+	s := NewMemoryStore()
+	take := func(wantGranted bool, wantRemaining int, wantRetry time.Duration) {
+		t.Helper()
+		granted, remaining, retry, err := s.Take("k", 2, 10*time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if granted != wantGranted || remaining != wantRemaining || retry != wantRetry {
+			t.Errorf("Take() = %t, %d, %v; want: %t, %d, %v",
+				granted, remaining, retry, wantGranted, wantRemaining, wantRetry)
+		}
+	}
+
+	take(true, 1, 0)
+	take(true, 0, 0)
+	take(false, 0, 5*time.Second)
+
+	cur = cur.Add(4 * time.Second)
+	take(false, 0, time.Second)
+	cur = cur.Add(time.Second)
+	take(true, 0, 0)
+
+	// Other keys have their own bucket.
+	if granted, _, _, _ := s.Take("other", 2, 10*time.Second); !granted {
+		t.Error("other key not granted")
+	}
+
+	// Full buckets are evicted.
+	cur = cur.Add(evictEvery)
+	take(true, 1, 0)
+	if l := len(s.buckets); l != 1 {
+		t.Errorf("%d buckets after eviction; want 1", l)
+	}
+
+	if _, _, _, err := s.Take("k", 0, time.Second); err != ErrInvalidRate {
+		t.Errorf("wrong error for invalid rate: %v", err)
+	}
+}
+
+func TestMemoryStoreZero(t *testing.T) {
+	var s MemoryStore
+	for i, want := range []bool{true, true, false} {
+		granted, _, _, err := s.Take("k", 2, 10*time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if granted != want {
+			t.Errorf("take %d: granted %t; want %t", i, granted, want)
+		}
+	}
+}
+
+func TestMemoryStoreConcurrent(t *testing.T) {
+	s := NewMemoryStore()
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		granted int
+	)
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ok, _, _, _ := s.Take("k", 10, time.Hour)
+			if ok {
+				mu.Lock()
+				granted++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if granted != 10 {
+		t.Errorf("granted %d requests; want 10", granted)
+	}
+}
+
+func TestRateLimitStore(t *testing.T) {
+	handler := RateLimit(Config{
+		Store: NewMemoryStore(),
+		Rates: func(*http.Request) (int, int) { return 1, 60 },
+	})(handle{}).ServeHTTP
+
+	req := &http.Request{RemoteAddr: "127.0.0.1", Header: http.Header{}}
+	rr := test.HTTP(t, req, handler)
+	if rr.Code != http.StatusOK {
+		t.Errorf("code %d; want %d", rr.Code, http.StatusOK)
+	}
+	if h := rr.Header().Get("Retry-After"); h != "" {
+		t.Errorf("Retry-After set on granted request: %q", h)
+	}
+
+	rr = test.HTTP(t, req, handler)
+	if rr.Code != http.StatusTooManyRequests {
+		t.Errorf("code %d; want %d", rr.Code, http.StatusTooManyRequests)
+	}
+	if h := rr.Header().Get("Retry-After"); h != "60" {
+		t.Errorf("Retry-After %q; want %q", h, "60")
+	}
+	if h := rr.Header().Get("X-Rate-Limit-Remaining"); h != "0" {
+		t.Errorf("X-Rate-Limit-Remaining %q; want %q", h, "0")
+	}
+}
@@ -0,0 +1,128 @@
+// Package realIPMiddleware resolves the client IP for requests from trusted
+// proxies, such as load balancers.
+//
+// The X-Forwarded-For and X-Real-IP headers are only used if the connecting
+// peer is a trusted proxy, as anyone can set them. The resolved IP is stored
+// in the request context and set as the host in r.RemoteAddr.
+package realIPMiddleware // import "github.com/teamwork/middleware/realIPMiddleware"
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// Config for the middleware.
+type Config struct {
+	// TrustedProxies is a list of CIDRs of trusted proxies, e.g. "10.0.0.0/8"
+	// or "::1/128". Headers from any other peer are ignored.
+	TrustedProxies []string
+}
+
+type contextKey int
+
+const ipKey contextKey = 0
+
+// FromContext gets the client IP from the context, or nil if the middleware
+// wasn't used.
+func FromContext(ctx context.Context) net.IP {
+	ip, _ := ctx.Value(ipKey).(net.IP)
+	return ip
+}
+
+// WithConfig returns a real IP middleware from config.
+//
+// It will panic if any of the TrustedProxies aren't a valid CIDR.
+func WithConfig(config Config) func(http.Handler) http.Handler {
+	trusted := make([]*net.IPNet, 0, len(config.TrustedProxies))
+	for _, c := range config.TrustedProxies {
+		_, n, err := net.ParseCIDR(c)
+		if err != nil {
+			panic(fmt.Sprintf("realIPMiddleware: invalid trusted proxy: %v", err))
+		}
+		trusted = append(trusted, n)
+	}
+
+	isTrusted := func(ip net.IP) bool {
+		for _, n := range trusted {
+			if n.Contains(ip) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			host, port, err := net.SplitHostPort(r.RemoteAddr)
+			if err != nil {
+				host = r.RemoteAddr
+			}
+			peer := net.ParseIP(host)
+			if peer == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			ip := peer
+			if isTrusted(peer) {
+				ip = clientIP(r.Header, peer, isTrusted)
+			}
+
+			r = r.WithContext(context.WithValue(r.Context(), ipKey, ip))
+			if port != "" {
+				r.RemoteAddr = net.JoinHostPort(ip.String(), port)
+			} else {
+				r.RemoteAddr = ip.String()
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// clientIP gets the client IP from the headers set by the trusted peer.
+//
+// X-Forwarded-For is read from right to left, as every proxy appends the
+// address it got the request from; the first untrusted address is the client.
+// If an address can't be parsed the last valid one is used, since anything to
+// the left of it can't be trusted.
+func clientIP(h http.Header, peer net.IP, isTrusted func(net.IP) bool) net.IP {
+	var hops []string
+	for _, xff := range h["X-Forwarded-For"] {
+		hops = append(hops, strings.Split(xff, ",")...)
+	}
+
+	if len(hops) == 0 {
+		if ip := parseIP(h.Get("X-Real-IP")); ip != nil {
+			return ip
+		}
+		return peer
+	}
+
+	ip := peer
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := parseIP(hops[i])
+		if hop == nil {
+			return ip
+		}
+		ip = hop
+		if !isTrusted(hop) {
+			return ip
+		}
+	}
+	return ip
+}
+
+// parseIP parses an IP address, which may have a port.
+func parseIP(s string) net.IP {
+	s = strings.TrimSpace(s)
+	if ip := net.ParseIP(s); ip != nil {
+		return ip
+	}
+	if host, _, err := net.SplitHostPort(s); err == nil {
+		return net.ParseIP(host)
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package realIPMiddleware
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/teamwork/test"
+)
+
+func TestRealIP(t *testing.T) {
+	config := Config{TrustedProxies: []string{"10.0.0.0/8", "::1/128"}}
+	cases := []struct {
+		remoteAddr string
+		header     http.Header
+		want       string
+		wantRemote string
+	}{
+		// Trusted proxy.
+		{"10.0.0.1:1234", http.Header{"X-Forwarded-For": {"1.2.3.4"}}, "1.2.3.4", "1.2.3.4:1234"},
+		{"[::1]:1234", http.Header{"X-Forwarded-For": {"1.2.3.4"}}, "1.2.3.4", "1.2.3.4:1234"},
+		{"10.0.0.1:1234", http.Header{"X-Forwarded-For": {"6.6.6.6, 1.2.3.4, 10.0.0.2"}},
+			"1.2.3.4", "1.2.3.4:1234"},
+		{"10.0.0.1:1234", http.Header{"X-Forwarded-For": {"6.6.6.6", "1.2.3.4"}}, "1.2.3.4", "1.2.3.4:1234"},
+		{"10.0.0.1:1234", http.Header{"X-Forwarded-For": {"1.2.3.4:5678"}}, "1.2.3.4", "1.2.3.4:1234"},
+		{"10.0.0.1:1234", http.Header{"X-Forwarded-For": {"10.0.0.3, 10.0.0.2"}}, "10.0.0.3", "10.0.0.3:1234"},
+		{"10.0.0.1:1234", http.Header{"X-Real-Ip": {"1.2.3.4"}}, "1.2.3.4", "1.2.3.4:1234"},
+		{"10.0.0.1:1234", http.Header{}, "10.0.0.1", "10.0.0.1:1234"},
+
+		// Untrusted peer.
+		{"5.5.5.5:1234", http.Header{"X-Forwarded-For": {"1.2.3.4"}}, "5.5.5.5", "5.5.5.5:1234"},
+		{"5.5.5.5:1234", http.Header{"X-Real-Ip": {"1.2.3.4"}}, "5.5.5.5", "5.5.5.5:1234"},
+
+		// Malformed X-Forwarded-For.
+		{"10.0.0.1:1234", http.Header{"X-Forwarded-For": {"1.2.3.4, nope"}}, "10.0.0.1", "10.0.0.1:1234"},
+		{"10.0.0.1:1234", http.Header{"X-Forwarded-For": {"nope, 10.0.0.2"}}, "10.0.0.2", "10.0.0.2:1234"},
+		{"10.0.0.1:1234", http.Header{"X-Forwarded-For": {""}}, "10.0.0.1", "10.0.0.1:1234"},
+		{"10.0.0.1:1234", http.Header{"X-Real-Ip": {"nope"}}, "10.0.0.1", "10.0.0.1:1234"},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%v", i), func(t *testing.T) {
+			var (
+				ip     net.IP
+				remote string
+			)
+			req := &http.Request{Method: "GET", RemoteAddr: tc.remoteAddr, Header: tc.header}
+			test.HTTP(t, req, WithConfig(config)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				ip = FromContext(r.Context())
+				remote = r.RemoteAddr
+			})).ServeHTTP)
+
+			if ip.String() != tc.want {
+				t.Errorf("IP: %v; want: %v", ip, tc.want)
+			}
+			if remote != tc.wantRemote {
+				t.Errorf("RemoteAddr: %v; want: %v", remote, tc.wantRemote)
+			}
+		})
+	}
+}
+
+func TestInvalidConfig(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("didn't panic")
+		}
+	}()
+	WithConfig(Config{TrustedProxies: []string{"10.0.0.1"}})
+}
@@ -0,0 +1,109 @@
+// Package requestIDMiddleware sets a request ID on every request.
+//
+// The ID is read from the incoming request header, or generated if the header
+// is absent or not a valid ID (see Valid). It's stored in the request context,
+// written back to the request header (so that e.g. rescueMiddleware picks it
+// up), and echoed in the response header.
+package requestIDMiddleware // import "github.com/teamwork/middleware/requestIDMiddleware"
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"net/http"
+)
+
+// Config for the middleware.
+type Config struct {
+	// Header to read the incoming request ID from and to set on the response.
+	// The default is X-Request-Id, which is what rescueMiddleware uses.
+	Header string
+
+	// Generate a new request ID; the default is a random UUID v4.
+	Generate func() string
+}
+
+// DefaultConfig is the default requestID middleware config.
+var DefaultConfig = Config{
+	Header:   "X-Request-Id",
+	Generate: UUID,
+}
+
+type contextKey int
+
+const requestIDKey contextKey = 0
+
+// FromContext gets the request ID from the context, or an empty string if
+// there is none.
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// Add the request ID middleware with the DefaultConfig.
+func Add(next http.Handler) http.Handler {
+	return WithConfig(DefaultConfig)(next)
+}
+
+// WithConfig returns a request ID middleware from config.
+func WithConfig(config Config) func(http.Handler) http.Handler {
+	if config.Header == "" {
+		config.Header = DefaultConfig.Header
+	}
+	if config.Generate == nil {
+		config.Generate = DefaultConfig.Generate
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := r.Header.Get(config.Header)
+			generated := id == "" || !Valid(id)
+			if generated {
+				id = config.Generate()
+			}
+
+			r = r.WithContext(context.WithValue(r.Context(), requestIDKey, id))
+			if generated {
+				// Copy the header too, so the caller's request isn't modified.
+				h := make(http.Header, len(r.Header)+1)
+				for k, v := range r.Header {
+					h[k] = v
+				}
+				h.Set(config.Header, id)
+				r.Header = h
+			}
+
+			w.Header().Set(config.Header, id)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Valid reports if a client-supplied request ID is safe to include in logs and
+// responses: up to 64 characters of [A-Za-z0-9._-]. rescueMiddleware uses the
+// same rules.
+func Valid(id string) bool {
+	if len(id) > 64 {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9',
+			c == '.', c == '_', c == '-':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// UUID generates a random (version 4) UUID.
+func UUID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("requestIDMiddleware: could not read random bytes: %v", err))
+	}
+	b[6] = (b[6] & 0x0f) | 0x40 // Version 4
+	b[8] = (b[8] & 0x3f) | 0x80 // Variant RFC 4122
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
@@ -0,0 +1,106 @@
+package requestIDMiddleware
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/teamwork/test"
+)
+
+func TestRequestID(t *testing.T) {
+	cases := []struct {
+		config     Config
+		reqHeader  http.Header
+		wantHeader string
+		wantID     string
+	}{
+		{DefaultConfig, http.Header{"X-Request-Id": {"abc"}}, "X-Request-Id", "abc"},
+		{Config{}, http.Header{"X-Request-Id": {"abc"}}, "X-Request-Id", "abc"},
+		{Config{Generate: func() string { return "gen" }}, http.Header{}, "X-Request-Id", "gen"},
+		{
+			Config{Header: "X-Correlation-Id", Generate: func() string { return "gen" }},
+			http.Header{"X-Request-Id": {"abc"}},
+			"X-Correlation-Id", "gen",
+		},
+		{
+			Config{Header: "X-Correlation-Id"},
+			http.Header{"X-Correlation-Id": {"abc"}},
+			"X-Correlation-Id", "abc",
+		},
+		{
+			Config{Generate: func() string { return "gen" }},
+			http.Header{"X-Request-Id": {`"><script>alert(1)</script>`}},
+			"X-Request-Id", "gen",
+		},
+		{
+			Config{Generate: func() string { return "gen" }},
+			http.Header{"X-Request-Id": {strings.Repeat("a", 65)}},
+			"X-Request-Id", "gen",
+		},
+		{Config{}, http.Header{"X-Request-Id": {strings.Repeat("a", 64)}}, "X-Request-Id", strings.Repeat("a", 64)},
+		{Config{}, http.Header{"X-Request-Id": {"a-Z_0.9"}}, "X-Request-Id", "a-Z_0.9"},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%v", i), func(t *testing.T) {
+			var ctxID, reqID string
+			rr := test.HTTP(t, &http.Request{Method: "GET", Header: tc.reqHeader},
+				WithConfig(tc.config)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					ctxID = FromContext(r.Context())
+					reqID = r.Header.Get(tc.wantHeader)
+				})).ServeHTTP)
+
+			if ctxID != tc.wantID {
+				t.Errorf("context ID: %q; want: %q", ctxID, tc.wantID)
+			}
+			if reqID != tc.wantID {
+				t.Errorf("request header: %q; want: %q", reqID, tc.wantID)
+			}
+			if h := rr.Header().Get(tc.wantHeader); h != tc.wantID {
+				t.Errorf("response header: %q; want: %q", h, tc.wantID)
+			}
+		})
+	}
+}
+
+func TestAdd(t *testing.T) {
+	var id string
+	rr := test.HTTP(t, &http.Request{Method: "GET", Header: http.Header{}},
+		Add(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id = FromContext(r.Context())
+		})).ServeHTTP)
+
+	uuid := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	if !uuid.MatchString(id) {
+		t.Errorf("not a UUID v4: %q", id)
+	}
+	if h := rr.Header().Get("X-Request-Id"); h != id {
+		t.Errorf("response header: %q; want: %q", h, id)
+	}
+}
+
+func TestRequestNotModified(t *testing.T) {
+	h := WithConfig(Config{Generate: func() string { return "gen" }})(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	req := &http.Request{Method: "GET", Header: http.Header{"X-Request-Id": {"in valid"}}}
+	test.HTTP(t, req, h.ServeHTTP)
+	if id := req.Header.Get("X-Request-Id"); id != "in valid" {
+		t.Errorf("caller's request header modified: %q", id)
+	}
+
+	// Nil header.
+	var id string
+	h = WithConfig(Config{Generate: func() string { return "gen" }})(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id = r.Header.Get("X-Request-Id")
+		}))
+	h.ServeHTTP(httptest.NewRecorder(), &http.Request{Method: "GET"})
+	if id != "gen" {
+		t.Errorf("request header: %q", id)
+	}
+}
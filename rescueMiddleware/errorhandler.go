@@ -0,0 +1,52 @@
+package rescueMiddleware
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/kr/pretty"
+)
+
+const (
+	recoveredErrorKey contextKey = iota + 1
+	recoveredStackKey
+)
+
+// RecoveredError gets the error of the panic()ed request. This is set on the
+// request passed to Config.ErrorHandler.
+func RecoveredError(r *http.Request) error {
+	err, _ := r.Context().Value(recoveredErrorKey).(error)
+	return err
+}
+
+// RecoveredStack gets the stack trace of the panic()ed request. This is set on
+// the request passed to Config.ErrorHandler.
+func RecoveredStack(r *http.Request) []byte {
+	stack, _ := r.Context().Value(recoveredStackKey).([]byte)
+	return stack
+}
+
+func withRecovered(r *http.Request, err error, stack []byte) *http.Request {
+	ctx := context.WithValue(r.Context(), recoveredErrorKey, err)
+	ctx = context.WithValue(ctx, recoveredStackKey, stack)
+	return r.WithContext(ctx)
+}
+
+// handleError calls the ErrorHandler, falling back to the default text
+// response if it panics.
+func (config Config) handleError(w http.ResponseWriter, r *http.Request) {
+	rw := &responseWriter{ResponseWriter: w}
+	defer func() {
+		if rec := recover(); rec != nil {
+			config.Log(r, pretty.Errorf("rescueMiddleware: ErrorHandler panicked: %v", rec))
+			if rw.written {
+				return
+			}
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(textMessage(RequestID(r)))) // nolint: errcheck
+		}
+	}()
+
+	config.ErrorHandler.ServeHTTP(rw, r)
+}
@@ -0,0 +1,46 @@
+package rescueMiddleware
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+
+	"github.com/teamwork/middleware/requestIDMiddleware"
+)
+
+type contextKey int
+
+const requestIDKey contextKey = 0
+
+// RequestID gets the request ID of the panic()ed request. This is set on the
+// request passed to Config.Log and the other callbacks.
+func RequestID(r *http.Request) string {
+	id, _ := r.Context().Value(requestIDKey).(string)
+	return id
+}
+
+func withRequestID(r *http.Request, id string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), requestIDKey, id))
+}
+
+// requestID gets the request ID from the request, or generates a new one.
+func (config Config) requestID(r *http.Request) string {
+	var id string
+	if config.RequestID != nil {
+		id = config.RequestID(r)
+	} else if h := r.Header.Get("X-Request-Id"); requestIDMiddleware.Valid(h) {
+		id = h
+	}
+	if id == "" {
+		id = newRequestID()
+	}
+	return id
+}
+
+// newRequestID generates a new random ID.
+func newRequestID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -7,78 +7,438 @@ package rescueMiddleware // import "github.com/teamwork/middleware/rescueMiddlew
 import (
 	"encoding/json"
 	"fmt"
+	"html"
+	"mime"
 	"net/http"
 	"os"
-	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/kr/pretty"
+	"github.com/pkg/errors"
 )
 
+// Config for the Rescue middleware.
+type Config struct {
+	// Log the error; the default is to print it to stderr.
+	Log func(*http.Request, error)
+
+	// Dev shows the panic in the browser.
+	Dev bool
+
+	// Responder writes the response to the client, instead of the default
+	// HTML, JSON, or text response. It's called after the error is logged.
+	//
+	// The middleware will still write the default text response if the
+	// Responder panics.
+	Responder func(w http.ResponseWriter, r *http.Request, err error)
+
+	// ErrorHandler writes the response to the client, instead of the default
+	// response, if Responder is nil. It can get the error and stack trace with
+	// RecoveredError() and RecoveredStack().
+	//
+	// The middleware will still write the default text response if the
+	// ErrorHandler panics.
+	ErrorHandler http.Handler
+
+	// StatusFunc gets the HTTP status code to use for a recovered value.
+	//
+	// The default is to use the StatusCode() of the recovered value if it
+	// implements StatusCoder, or 500 otherwise.
+	StatusFunc func(rec interface{}) int
+
+	// Templates gets the templates to use for the response, for example to
+	// translate the message to the user's language. The default messages are
+	// used if this is nil or if a template is nil.
+	Templates func(*http.Request) Templates
+
+	// RequestID gets the request ID, which is included in the response so
+	// that users can report it, and can be retrieved with RequestID() in the
+	// Log function and other callbacks.
+	//
+	// The default is to use the X-Request-Id header if it's at most 64
+	// characters of [A-Za-z0-9._-]; a new random ID is generated if the header
+	// is invalid or this returns an empty string.
+	RequestID func(*http.Request) string
+
+	// OnPanic is called for every recovered panic, in order, after it's
+	// logged but before the response is written. This can be used to e.g.
+	// update metrics.
+	//
+	// Panics in the hooks are recovered and logged.
+	OnPanic []func(r *http.Request, rec interface{}, stack []byte)
+
+	// MaxStackFrames is the maximum number of frames in the stack trace passed
+	// to OnPanic and shown on dev. The default is 32.
+	MaxStackFrames int
+
+	// LogEvery logs identical panics (same error message and panic site) only
+	// once in this interval; the response is still written for every panic.
+	// The number of panics that weren't logged is added to the error the next
+	// time it's logged, if that's within two intervals of the last log.
+	//
+	// The default of 0 logs all panics.
+	LogEvery time.Duration
+
+	// ShouldReport is called with the recovered value to decide if it should
+	// be passed to Log; this can be used for expected errors such as client
+	// disconnects. The response is still written.
+	//
+	// The default is to report everything.
+	ShouldReport func(rec interface{}) bool
+
+	// LogUnreported is called instead of Log for panics that ShouldReport
+	// returns false for, e.g. for a lower-severity local log.
+	LogUnreported func(*http.Request, error)
+
+	// PanicCounter is called once for every recovered panic with the status
+	// code from StatusFunc, e.g. to increment a Prometheus counter:
+	//
+	//	PanicCounter: func(status int) {
+	//		panics.WithLabelValues(strconv.Itoa(status)).Inc()
+	//	}
+	PanicCounter func(status int)
+}
+
+const defaultMessage = "Sorry, the server ran into a problem processing this request."
+
+// textMessage gets the default text response.
+func textMessage(requestID string) string {
+	return defaultMessage + "\n\nRequest ID: " + requestID
+}
+
+// StatusCoder can be implemented by panic()ed values to set the HTTP status
+// code of the response.
+type StatusCoder interface {
+	StatusCode() int
+}
+
+// status gets the HTTP status code for the recovered value.
+func (config Config) status(rec interface{}) int {
+	if config.StatusFunc != nil {
+		if s := config.StatusFunc(rec); s > 0 {
+			return s
+		}
+	}
+	if sc, ok := rec.(StatusCoder); ok && sc.StatusCode() > 0 {
+		return sc.StatusCode()
+	}
+	return http.StatusInternalServerError
+}
+
 // Rescue from panic()s in any of the lower middleware or HTTP handlers.
 //
-// The extraFields callback can be used to add extra fields to the log (such as
-// perhaps a installation ID or user ID from the session).
+// The log callback is called with the panic error, and defaults to printing it
+// to stderr if nil. The error and stack trace are shown in the response if dev
+// is true. Use WithConfig for more options.
 func Rescue(
 	log func(*http.Request, error),
 	dev bool,
 ) func(http.Handler) http.Handler {
+	return WithConfig(Config{Log: log, Dev: dev})
+}
 
-	if log == nil {
-		log = func(r *http.Request, err error) {
-			fmt.Fprintf(os.Stderr, "%v: %v", r.URL.Path, err)
-		}
+// WithConfig returns a Rescue middleware from config.
+func WithConfig(config Config) func(http.Handler) http.Handler {
+	if config.Log == nil {
+		config.Log = defaultLog
+	}
+
+	var th *throttle
+	if config.LogEvery > 0 {
+		th = newThrottle(config.LogEvery)
 	}
 
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rw := &responseWriter{ResponseWriter: w}
 
 			defer func() {
 				rec := recover()
 				if rec == nil {
 					return
 				}
-
-				var err error
-				switch rec := rec.(type) {
-				case error:
-					err = rec
-				case map[string]interface{}:
-					err, _ = rec["error"].(error)
-				default:
-					err = pretty.Errorf("%v", rec)
+				// Used by net/http to abort the connection; let it handle
+				// that.
+				if rec == http.ErrAbortHandler {
+					panic(rec)
 				}
 
-				log(r, err)
-
-				w.WriteHeader(http.StatusInternalServerError)
+				err := toError(rec)
+				stack := stack(config.MaxStackFrames)
+				status := config.status(rec)
+				r = withRequestID(r, config.requestID(r))
+				if config.PanicCounter != nil {
+					config.PanicCounter(status)
+				}
 
+				log := true
+				logErr := err
 				switch {
-				// Show panic in browser on dev.
-				case dev:
-					if r.Header.Get("X-Requested-With") == "XMLHttpRequest" {
-						w.Write([]byte(err.Error())) // nolint: errcheck
-						return
+				case config.ShouldReport != nil && !config.ShouldReport(rec):
+					log = false
+					if config.LogUnreported != nil {
+						config.LogUnreported(r, err)
 					}
+				case th != nil:
+					log, logErr = th.check(err, stack)
+				}
 
-					// nolint: errcheck
-					w.Write([]byte(fmt.Sprintf("<h2>%v</h2><pre>%s</pre>",
-						err, debug.Stack())))
-
-				// JSON response for AJAX.
-				case r.Header.Get("X-Requested-With") == "XMLHttpRequest":
-					b, _ := json.Marshal(map[string]interface{}{
-						"message": "Sorry, the server ran into a problem processing this request.",
-					})
-					w.Header().Add("Content-Type", "application/json")
-					w.Write(b) // nolint: errcheck
-
-				// Fall back to text.
-				default:
-					w.Write([]byte("Sorry, the server ran into a problem processing this request.")) // nolint: errcheck
+				// We can't send a different status code or a sensible body
+				// if the handler already started writing the response.
+				if rw.written {
+					if log {
+						config.Log(r, errors.Wrap(logErr, "rescueMiddleware: response already written"))
+					}
+					config.runHooks(r, rec, stack)
+					return
+				}
+
+				if log {
+					config.Log(r, logErr)
 				}
+				config.runHooks(r, rec, stack)
+
+				if config.Responder != nil {
+					config.respond(w, r, err)
+					return
+				}
+				if config.ErrorHandler != nil {
+					config.handleError(w, withRecovered(r, err, stack))
+					return
+				}
+				config.writeDefault(w, r, err, stack, status)
 			}()
 
-			next.ServeHTTP(w, r)
+			next.ServeHTTP(rw, r)
 		})
 	}
 }
+
+// Go runs fn in a new goroutine, recovering and logging any panic()s the same
+// way as Rescue does. No response is written, as the request may have finished
+// already.
+//
+// The request is only passed to log, and may be nil if log accepts that.
+func Go(r *http.Request, log func(*http.Request, error), fn func()) {
+	if log == nil {
+		log = defaultLog
+	}
+
+	go func() {
+		defer func() {
+			rec := recover()
+			if rec == nil {
+				return
+			}
+			log(r, toError(rec))
+		}()
+
+		fn()
+	}()
+}
+
+func defaultLog(r *http.Request, err error) {
+	if r == nil || r.URL == nil {
+		fmt.Fprintf(os.Stderr, "%v", err)
+		return
+	}
+	fmt.Fprintf(os.Stderr, "%v: %v", r.URL.Path, err)
+}
+
+// toError converts a recover()ed value to an error.
+func toError(rec interface{}) error {
+	var err error
+	switch rec := rec.(type) {
+	case error:
+		err = rec
+	case map[string]interface{}:
+		err, _ = rec["error"].(error)
+	}
+	if err == nil {
+		err = pretty.Errorf("%v", rec)
+	}
+	return err
+}
+
+// runHooks runs all OnPanic hooks.
+func (config Config) runHooks(r *http.Request, rec interface{}, stack []byte) {
+	for _, h := range config.OnPanic {
+		func() {
+			defer func() {
+				if hrec := recover(); hrec != nil {
+					config.Log(r, errors.Wrap(toError(hrec), "rescueMiddleware: OnPanic hook panicked"))
+				}
+			}()
+			h(r, rec, stack)
+		}()
+	}
+}
+
+// respond calls the Responder, falling back to the default text response if
+// it panics.
+func (config Config) respond(w http.ResponseWriter, r *http.Request, err error) {
+	rw := &responseWriter{ResponseWriter: w}
+	defer func() {
+		if rec := recover(); rec != nil {
+			config.Log(r, pretty.Errorf("rescueMiddleware: Responder panicked: %v", rec))
+			if rw.written {
+				return
+			}
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(textMessage(RequestID(r)))) // nolint: errcheck
+		}
+	}()
+
+	config.Responder(rw, r, err)
+}
+
+// writeDefault writes the default HTML, JSON, or text response.
+func (config Config) writeDefault(w http.ResponseWriter, r *http.Request, err error, stack []byte, status int) {
+	var tpl Templates
+	if config.Templates != nil {
+		tpl = config.Templates(r)
+	}
+	id := RequestID(r)
+	data := TemplateData{Status: status, Message: defaultMessage, RequestID: id}
+	typ := responseType(w, r)
+
+	switch {
+	// Show panic in browser on dev.
+	case config.Dev:
+		if typ == typeJSON {
+			b, _ := json.Marshal(map[string]interface{}{
+				"error":      err.Error(),
+				"stack":      string(stack),
+				"request_id": id,
+			})
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(status)
+			w.Write(b) // nolint: errcheck
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(status)
+		// nolint: errcheck
+		w.Write([]byte(fmt.Sprintf("<h2>%s</h2><pre>%s</pre>",
+			html.EscapeString(err.Error()), html.EscapeString(string(stack)))))
+
+	// JSON response for AJAX.
+	case typ == typeJSON:
+		var b []byte
+		if tpl.JSON != nil {
+			b = config.execute(r, tpl.JSON, data)
+		}
+		if b == nil {
+			b, _ = json.Marshal(map[string]interface{}{
+				"message":    defaultMessage,
+				"request_id": id,
+			})
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write(b) // nolint: errcheck
+
+	// HTML or text from templates.
+	case tpl.HTML != nil || tpl.Text != nil:
+		var b []byte
+		if tpl.HTML != nil {
+			b = config.execute(r, tpl.HTML, data)
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		}
+		if b == nil && tpl.Text != nil {
+			b = config.execute(r, tpl.Text, data)
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		}
+		if b == nil {
+			b = []byte(textMessage(id))
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		}
+		w.WriteHeader(status)
+		w.Write(b) // nolint: errcheck
+
+	// HTML if the handler already set that Content-Type.
+	case typ == typeHTML:
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(status)
+		// nolint: errcheck
+		w.Write([]byte(fmt.Sprintf("<p>%s</p><p>Request ID: %s</p>",
+			html.EscapeString(defaultMessage), html.EscapeString(id))))
+
+	// Fall back to text.
+	default:
+		// Don't leave a Content-Type that doesn't match from the handler.
+		if w.Header().Get("Content-Type") != "" {
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		}
+		w.WriteHeader(status)
+		w.Write([]byte(textMessage(id))) // nolint: errcheck
+	}
+}
+
+// Response types for writeDefault.
+const (
+	typeText = iota
+	typeJSON
+	typeHTML
+)
+
+// responseType gets the type of the default response. The Content-Type the
+// handler set before panicking takes precedence, since the client presumably
+// expects that; otherwise it depends on the request headers.
+func responseType(w http.ResponseWriter, r *http.Request) int {
+	if ct := w.Header().Get("Content-Type"); ct != "" {
+		mt, _, err := mime.ParseMediaType(ct)
+		switch {
+		case err != nil:
+		case mt == "application/json" || strings.HasSuffix(mt, "+json"):
+			return typeJSON
+		case mt == "text/html":
+			return typeHTML
+		}
+	}
+
+	if wantsJSON(r) {
+		return typeJSON
+	}
+	return typeText
+}
+
+// wantsJSON reports if the client wants a JSON response; this is the case for
+// AJAX requests, or if the Accept header prefers JSON over HTML.
+func wantsJSON(r *http.Request) bool {
+	if r.Header.Get("X-Requested-With") == "XMLHttpRequest" {
+		return true
+	}
+
+	jsonQ, htmlQ := 0.0, 0.0
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		mt, params, err := mime.ParseMediaType(accept)
+		if err != nil {
+			continue
+		}
+
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			q, err = strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+		}
+
+		switch {
+		case mt == "application/json" || strings.HasSuffix(mt, "+json"):
+			if q > jsonQ {
+				jsonQ = q
+			}
+		case mt == "text/html":
+			if q > htmlQ {
+				htmlQ = q
+			}
+		}
+	}
+	return jsonQ > htmlQ
+}
@@ -1,9 +1,16 @@
 package rescueMiddleware
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/teamwork/middleware/requestIDMiddleware"
 	"github.com/teamwork/test"
 )
 
@@ -39,8 +46,661 @@ func TestRescuePanic(t *testing.T) {
 		t.Errorf("want code %v, got %v", 200, rr.Code)
 	}
 
-	want := "Sorry, the server ran into a problem processing this request."
+	want := "Sorry, the server ran into a problem processing this request.\n\nRequest ID: "
+	if b := rr.Body.String(); !strings.HasPrefix(b, want) || len(b) != len(want)+32 {
+		t.Errorf("body wrong:\nwant: %#v\ngot:  %#v\n", want, b)
+	}
+}
+
+func TestResponder(t *testing.T) {
+	var logged error
+	rr := test.HTTP(t, nil, WithConfig(Config{
+		Log: func(r *http.Request, err error) { logged = err },
+		Responder: func(w http.ResponseWriter, r *http.Request, err error) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_, _ = w.Write([]byte("custom: " + err.Error()))
+		},
+	})(panicy{}).ServeHTTP)
+
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("want code %v, got %v", http.StatusServiceUnavailable, rr.Code)
+	}
+	if logged == nil {
+		t.Error("error not logged")
+	}
+	want := "custom: oh noes!"
 	if b := rr.Body.String(); b != want {
 		t.Errorf("body wrong:\nwant: %#v\ngot:  %#v\n", want, b)
 	}
 }
+
+func TestResponderPanic(t *testing.T) {
+	var logged []error
+	rr := test.HTTP(t, nil, WithConfig(Config{
+		Log: func(r *http.Request, err error) { logged = append(logged, err) },
+		Responder: func(w http.ResponseWriter, r *http.Request, err error) {
+			w.Header().Set("Content-Type", "application/json")
+			panic("responder broke")
+		},
+		RequestID: func(*http.Request) string { return "abc" },
+	})(panicy{}).ServeHTTP)
+
+	if rr.Code != 500 {
+		t.Errorf("want code %v, got %v", 500, rr.Code)
+	}
+	if ct := rr.Header().Get("Content-Type"); ct != "text/plain; charset=utf-8" {
+		t.Errorf("wrong Content-Type: %#v", ct)
+	}
+	if len(logged) != 2 {
+		t.Errorf("want 2 logged errors, got %v", logged)
+	}
+	want := "Sorry, the server ran into a problem processing this request.\n\nRequest ID: abc"
+	if b := rr.Body.String(); b != want {
+		t.Errorf("body wrong:\nwant: %#v\ngot:  %#v\n", want, b)
+	}
+}
+
+func TestResponderPanicAfterWrite(t *testing.T) {
+	var logged []error
+	rr := test.HTTP(t, nil, WithConfig(Config{
+		Log: func(r *http.Request, err error) { logged = append(logged, err) },
+		Responder: func(w http.ResponseWriter, r *http.Request, err error) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_, _ = w.Write([]byte("partial"))
+			panic("responder broke")
+		},
+	})(panicy{}).ServeHTTP)
+
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("want code %v, got %v", http.StatusServiceUnavailable, rr.Code)
+	}
+	if b := rr.Body.String(); b != "partial" {
+		t.Errorf("body wrong: %#v", b)
+	}
+	if len(logged) != 2 {
+		t.Errorf("want 2 logged errors, got %v", logged)
+	}
+}
+
+func TestRescueAccept(t *testing.T) {
+	text := "Sorry, the server ran into a problem processing this request.\n\nRequest ID: abc"
+	json := `{"message":"Sorry, the server ran into a problem processing this request.","request_id":"abc"}`
+
+	cases := []struct {
+		header http.Header
+		want   string
+	}{
+		{http.Header{}, text},
+		{http.Header{"Accept": {"text/html"}}, text},
+		{http.Header{"Accept": {"application/json"}}, json},
+		{http.Header{"Accept": {"application/problem+json"}}, json},
+		{http.Header{"Accept": {"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8"}}, text},
+		{http.Header{"Accept": {"text/html;q=0.5, application/json"}}, json},
+		{http.Header{"Accept": {"text/html, application/json;q=0.5"}}, text},
+		{http.Header{"Accept": {"*/*"}}, text},
+		{http.Header{"X-Requested-With": {"XMLHttpRequest"}}, json},
+		{http.Header{"X-Requested-With": {"XMLHttpRequest"}, "Accept": {"text/html"}}, json},
+	}
+
+	for _, tc := range cases {
+		t.Run(fmt.Sprintf("%v", tc.header), func(t *testing.T) {
+			req, err := http.NewRequest("GET", "/", nil)
+			if err != nil {
+				t.Fatalf("cannot make request: %v", err)
+			}
+			req.Header = tc.header
+			req.Header.Set("X-Request-Id", "abc")
+
+			rr := test.HTTP(t, req, Rescue(nil, false)(panicy{}).ServeHTTP)
+
+			if rr.Code != 500 {
+				t.Errorf("want code %v, got %v", 500, rr.Code)
+			}
+			if b := rr.Body.String(); b != tc.want {
+				t.Errorf("body wrong:\nwant: %#v\ngot:  %#v\n", tc.want, b)
+			}
+		})
+	}
+}
+
+func TestRescueContentType(t *testing.T) {
+	text := "Sorry, the server ran into a problem processing this request.\n\nRequest ID: abc"
+	json := `{"message":"Sorry, the server ran into a problem processing this request.","request_id":"abc"}`
+	html := "<p>Sorry, the server ran into a problem processing this request.</p><p>Request ID: abc</p>"
+
+	cases := []struct {
+		contentType     string
+		accept          string
+		want            string
+		wantContentType string
+	}{
+		{"application/json", "", json, "application/json"},
+		{"application/vnd.api+json; charset=utf-8", "text/html", json, "application/json"},
+		{"text/html; charset=utf-8", "application/json", html, "text/html; charset=utf-8"},
+		{"text/csv", "", text, "text/plain; charset=utf-8"},
+		{"text/csv", "application/json", json, "application/json"},
+		{"invalid;;", "", text, "text/plain; charset=utf-8"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.contentType, func(t *testing.T) {
+			req, err := http.NewRequest("GET", "/", nil)
+			if err != nil {
+				t.Fatalf("cannot make request: %v", err)
+			}
+			req.Header.Set("X-Request-Id", "abc")
+			if tc.accept != "" {
+				req.Header.Set("Accept", tc.accept)
+			}
+
+			rr := test.HTTP(t, req, Rescue(nil, false)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", tc.contentType)
+				panic("oh noes")
+			})).ServeHTTP)
+
+			if rr.Code != 500 {
+				t.Errorf("want code %v, got %v", 500, rr.Code)
+			}
+			if b := rr.Body.String(); b != tc.want {
+				t.Errorf("body wrong:\nwant: %#v\ngot:  %#v\n", tc.want, b)
+			}
+			if ct := rr.Header().Get("Content-Type"); ct != tc.wantContentType {
+				t.Errorf("Content-Type wrong:\nwant: %#v\ngot:  %#v\n", tc.wantContentType, ct)
+			}
+		})
+	}
+}
+
+type httpError struct{ code int }
+
+func (e httpError) Error() string   { return fmt.Sprintf("http error %d", e.code) }
+func (e httpError) StatusCode() int { return e.code }
+
+func TestRescueStatus(t *testing.T) {
+	cases := []struct {
+		rec        interface{}
+		statusFunc func(interface{}) int
+		header     http.Header
+		dev        bool
+		want       int
+	}{
+		{"oh noes!", nil, http.Header{}, false, 500},
+		{httpError{400}, nil, http.Header{}, false, 400},
+		{httpError{400}, nil, http.Header{"Accept": {"application/json"}}, false, 400},
+		{httpError{400}, nil, http.Header{}, true, 400},
+		{httpError{0}, nil, http.Header{}, false, 500},
+		{"oh noes!", func(interface{}) int { return 418 }, http.Header{}, false, 418},
+		{httpError{400}, func(interface{}) int { return 418 }, http.Header{}, false, 418},
+		{httpError{400}, func(interface{}) int { return 0 }, http.Header{}, false, 400},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%v", i), func(t *testing.T) {
+			req, err := http.NewRequest("GET", "/", nil)
+			if err != nil {
+				t.Fatalf("cannot make request: %v", err)
+			}
+			req.Header = tc.header
+
+			h := WithConfig(Config{
+				Log:        func(*http.Request, error) {},
+				Dev:        tc.dev,
+				StatusFunc: tc.statusFunc,
+			})(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+				panic(tc.rec)
+			}))
+
+			rr := test.HTTP(t, req, h.ServeHTTP)
+			if rr.Code != tc.want {
+				t.Errorf("want code %v, got %v", tc.want, rr.Code)
+			}
+		})
+	}
+}
+
+func TestRescueAbortHandler(t *testing.T) {
+	logged := false
+	h := WithConfig(Config{
+		Log: func(*http.Request, error) { logged = true },
+	})(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		panic(http.ErrAbortHandler)
+	}))
+
+	rr := httptest.NewRecorder()
+	func() {
+		defer func() {
+			if rec := recover(); rec != http.ErrAbortHandler {
+				t.Errorf("want panic with http.ErrAbortHandler, got %#v", rec)
+			}
+		}()
+		h.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+	}()
+
+	if logged {
+		t.Error("http.ErrAbortHandler was logged")
+	}
+	if rr.Body.Len() > 0 {
+		t.Errorf("body written: %#v", rr.Body.String())
+	}
+
+	// Other errors are still handled.
+	h = WithConfig(Config{
+		Log: func(*http.Request, error) { logged = true },
+	})(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		panic(errors.New("oh noes"))
+	}))
+	rr = test.HTTP(t, nil, h.ServeHTTP)
+	if !logged {
+		t.Error("error not logged")
+	}
+	if rr.Code != 500 {
+		t.Errorf("want code %v, got %v", 500, rr.Code)
+	}
+}
+
+func TestGo(t *testing.T) {
+	req := httptest.NewRequest("GET", "/background", nil)
+	logged := make(chan error, 1)
+	ran := make(chan struct{})
+
+	Go(req, func(r *http.Request, err error) {
+		if r != req {
+			t.Errorf("wrong request: %#v", r)
+		}
+		logged <- err
+	}, func() {
+		close(ran)
+		panic("oh noes!")
+	})
+
+	<-ran
+	select {
+	case err := <-logged:
+		if err == nil || err.Error() != "oh noes!" {
+			t.Errorf("wrong error: %#v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("panic not logged")
+	}
+}
+
+func TestRescueWritten(t *testing.T) {
+	var logged error
+	rr := test.HTTP(t, nil, WithConfig(Config{
+		Log: func(r *http.Request, err error) { logged = err },
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("partial"))
+		panic("oh noes!")
+	})).ServeHTTP)
+
+	if rr.Code != 200 {
+		t.Errorf("want code %v, got %v", 200, rr.Code)
+	}
+	if b := rr.Body.String(); b != "partial" {
+		t.Errorf("body wrong:\nwant: %#v\ngot:  %#v\n", "partial", b)
+	}
+	want := "rescueMiddleware: response already written: oh noes!"
+	if logged == nil || logged.Error() != want {
+		t.Errorf("wrong error logged:\nwant: %#v\ngot:  %#v\n", want, logged)
+	}
+}
+
+func TestRescueRequestID(t *testing.T) {
+	cases := []struct {
+		name      string
+		requestID func(*http.Request) string
+		header    string
+		accept    string
+		want      string // Empty for generated IDs.
+	}{
+		{"generated", nil, "", "text/html", ""},
+		{"header", nil, "from-header", "text/html", "from-header"},
+		{"header json", nil, "from-header", "application/json", "from-header"},
+		{"func", func(*http.Request) string { return "from-func" }, "from-header", "text/html", "from-func"},
+		{"func empty", func(*http.Request) string { return "" }, "from-header", "text/html", ""},
+		{"header invalid", nil, `"><script>alert(1)</script>`, "text/html", ""},
+		{"header too long", nil, strings.Repeat("a", 65), "text/html", ""},
+		{"header max length", nil, strings.Repeat("a", 64), "text/html", strings.Repeat("a", 64)},
+		{"header charset", nil, "a-Z_0.9", "application/json", "a-Z_0.9"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.Header.Set("Accept", tc.accept)
+			if tc.header != "" {
+				req.Header.Set("X-Request-Id", tc.header)
+			}
+
+			var loggedID string
+			rr := test.HTTP(t, req, WithConfig(Config{
+				Log:       func(r *http.Request, err error) { loggedID = RequestID(r) },
+				RequestID: tc.requestID,
+			})(panicy{}).ServeHTTP)
+
+			if loggedID == "" || (tc.want != "" && loggedID != tc.want) {
+				t.Fatalf("wrong request ID in log: %#v", loggedID)
+			}
+			if tc.want == "" && loggedID == tc.header {
+				t.Fatalf("request ID not generated: %#v", loggedID)
+			}
+
+			b := rr.Body.String()
+			if tc.accept == "application/json" {
+				var out map[string]string
+				if err := json.Unmarshal([]byte(b), &out); err != nil {
+					t.Fatal(err)
+				}
+				if out["request_id"] != loggedID {
+					t.Errorf("wrong request_id in body: %#v; want %#v", out["request_id"], loggedID)
+				}
+				return
+			}
+			if !strings.HasSuffix(b, "\n\nRequest ID: "+loggedID) {
+				t.Errorf("request ID %#v not in body: %#v", loggedID, b)
+			}
+		})
+	}
+}
+
+func TestRescueOnPanic(t *testing.T) {
+	var calls []string
+	var logged []error
+	rr := test.HTTP(t, nil, WithConfig(Config{
+		Log: func(r *http.Request, err error) { logged = append(logged, err) },
+		OnPanic: []func(*http.Request, interface{}, []byte){
+			func(r *http.Request, rec interface{}, stack []byte) {
+				if rec != "oh noes!" {
+					t.Errorf("wrong recovered value: %#v", rec)
+				}
+				if !strings.Contains(string(stack), "panicy.ServeHTTP") {
+					t.Errorf("panic site not in stack:\n%s", stack)
+				}
+				calls = append(calls, "first")
+			},
+			func(*http.Request, interface{}, []byte) {
+				calls = append(calls, "second")
+				panic("hook broke")
+			},
+			func(*http.Request, interface{}, []byte) {
+				calls = append(calls, "third")
+			},
+		},
+	})(panicy{}).ServeHTTP)
+
+	if fmt.Sprint(calls) != "[first second third]" {
+		t.Errorf("wrong calls: %v", calls)
+	}
+	if len(logged) != 2 || !strings.Contains(logged[1].Error(), "hook broke") {
+		t.Errorf("wrong logged errors: %v", logged)
+	}
+	if rr.Code != 500 {
+		t.Errorf("want code %v, got %v", 500, rr.Code)
+	}
+}
+
+func TestRescueStack(t *testing.T) {
+	var stack []byte
+	rr := test.HTTP(t, nil, WithConfig(Config{
+		Log: func(*http.Request, error) {},
+		Dev: true,
+		OnPanic: []func(*http.Request, interface{}, []byte){
+			func(r *http.Request, rec interface{}, s []byte) { stack = s },
+		},
+	})(panicy{}).ServeHTTP)
+
+	first := strings.SplitN(string(stack), "\n", 2)[0]
+	if first != "github.com/teamwork/middleware/rescueMiddleware.panicy.ServeHTTP()" {
+		t.Errorf("stack doesn't start at the panic:\n%s", stack)
+	}
+	if !strings.Contains(rr.Body.String(), string(stack)) {
+		t.Errorf("stack not in dev output:\n%s", rr.Body.String())
+	}
+}
+
+type nilPanic struct{}
+
+func (h nilPanic) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var m map[string]int
+	m["x"]++
+}
+
+func deep(n int) {
+	if n == 0 {
+		panic("deep")
+	}
+	deep(n - 1)
+}
+
+func TestRescueStackTrim(t *testing.T) {
+	cases := []struct {
+		handler   http.Handler
+		max       int
+		wantFirst string
+		wantLines int
+	}{
+		{nilPanic{}, 0, "github.com/teamwork/middleware/rescueMiddleware.nilPanic.ServeHTTP()", -1},
+		{http.HandlerFunc(func(http.ResponseWriter, *http.Request) { deep(100) }), 0,
+			"github.com/teamwork/middleware/rescueMiddleware.deep()", 32*2 + 1},
+		{http.HandlerFunc(func(http.ResponseWriter, *http.Request) { deep(100) }), 5,
+			"github.com/teamwork/middleware/rescueMiddleware.deep()", 5*2 + 1},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%v", i), func(t *testing.T) {
+			var stack []byte
+			test.HTTP(t, nil, WithConfig(Config{
+				Log:            func(*http.Request, error) {},
+				MaxStackFrames: tc.max,
+				OnPanic: []func(*http.Request, interface{}, []byte){
+					func(r *http.Request, rec interface{}, s []byte) { stack = s },
+				},
+			})(tc.handler).ServeHTTP)
+
+			lines := strings.Split(strings.TrimSpace(string(stack)), "\n")
+			if lines[0] != tc.wantFirst {
+				t.Errorf("wrong first frame %#v:\n%s", lines[0], stack)
+			}
+			if tc.wantLines > -1 && len(lines) != tc.wantLines {
+				t.Errorf("want %d lines, got %d:\n%s", tc.wantLines, len(lines), stack)
+			}
+		})
+	}
+}
+
+func TestRescueShouldReport(t *testing.T) {
+	errExpected := errors.New("client went away")
+	cases := []struct {
+		rec            interface{}
+		wantReported   bool
+		wantUnreported bool
+	}{
+		{errors.New("oh noes"), true, false},
+		{errExpected, false, true},
+	}
+
+	for _, tc := range cases {
+		t.Run(fmt.Sprintf("%v", tc.rec), func(t *testing.T) {
+			reported, unreported := false, false
+			rr := test.HTTP(t, nil, WithConfig(Config{
+				Log:           func(*http.Request, error) { reported = true },
+				LogUnreported: func(*http.Request, error) { unreported = true },
+				ShouldReport:  func(rec interface{}) bool { return rec != errExpected },
+			})(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+				panic(tc.rec)
+			})).ServeHTTP)
+
+			if reported != tc.wantReported {
+				t.Errorf("reported: %t; want: %t", reported, tc.wantReported)
+			}
+			if unreported != tc.wantUnreported {
+				t.Errorf("unreported: %t; want: %t", unreported, tc.wantUnreported)
+			}
+			if rr.Code != 500 {
+				t.Errorf("want code %v, got %v", 500, rr.Code)
+			}
+		})
+	}
+}
+
+func TestRescuePanicCounter(t *testing.T) {
+	var counts []int
+	mw := WithConfig(Config{
+		Log:          func(*http.Request, error) {},
+		PanicCounter: func(status int) { counts = append(counts, status) },
+	})
+
+	test.HTTP(t, nil, mw(handle{}).ServeHTTP)
+	if len(counts) != 0 {
+		t.Fatalf("counted normal request: %v", counts)
+	}
+
+	test.HTTP(t, nil, mw(panicy{}).ServeHTTP)
+	test.HTTP(t, nil, mw(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		panic(httpError{http.StatusBadGateway})
+	})).ServeHTTP)
+
+	want := []int{500, 502}
+	if fmt.Sprint(counts) != fmt.Sprint(want) {
+		t.Errorf("counts: %v; want: %v", counts, want)
+	}
+}
+
+func TestRescueDev(t *testing.T) {
+	mw := WithConfig(Config{
+		Log: func(*http.Request, error) {},
+		Dev: true,
+	})
+	h := mw(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		panic(errors.New(`<script>alert("x")</script>`))
+	}))
+
+	t.Run("html", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/", nil)
+		rr := test.HTTP(t, req, h.ServeHTTP)
+
+		b := rr.Body.String()
+		want := "<h2>&lt;script&gt;alert(&#34;x&#34;)&lt;/script&gt;</h2><pre>"
+		if !strings.HasPrefix(b, want) {
+			t.Errorf("body wrong:\nwant prefix: %#v\ngot:         %#v\n", want, b)
+		}
+		if strings.Contains(b, "<script>") {
+			t.Errorf("not escaped: %s", b)
+		}
+		if ct := rr.Header().Get("Content-Type"); ct != "text/html; charset=utf-8" {
+			t.Errorf("Content-Type wrong: %#v", ct)
+		}
+	})
+
+	t.Run("json", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Accept", "application/json")
+		req.Header.Set("X-Request-Id", "abc")
+		rr := test.HTTP(t, req, h.ServeHTTP)
+
+		var out struct {
+			Error     string `json:"error"`
+			Stack     string `json:"stack"`
+			RequestID string `json:"request_id"`
+		}
+		if err := json.Unmarshal(rr.Body.Bytes(), &out); err != nil {
+			t.Fatalf("invalid JSON: %v\n%s", err, rr.Body.String())
+		}
+		if out.Error != `<script>alert("x")</script>` || out.RequestID != "abc" {
+			t.Errorf("wrong JSON: %#v", out)
+		}
+		if !strings.Contains(out.Stack, "TestRescueDev") {
+			t.Errorf("no stack in JSON: %#v", out.Stack)
+		}
+		if ct := rr.Header().Get("Content-Type"); ct != "application/json" {
+			t.Errorf("Content-Type wrong: %#v", ct)
+		}
+	})
+}
+
+func TestRescueErrorHandler(t *testing.T) {
+	var (
+		gotErr   error
+		gotStack []byte
+		logged   []error
+	)
+	h := WithConfig(Config{
+		Log: func(r *http.Request, err error) { logged = append(logged, err) },
+		ErrorHandler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			gotErr = RecoveredError(r)
+			gotStack = RecoveredStack(r)
+			w.WriteHeader(http.StatusTeapot)
+			_, _ = w.Write([]byte("error page for " + RequestID(r)))
+		}),
+	})(panicy{})
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("X-Request-Id", "abc")
+	rr := test.HTTP(t, req, h.ServeHTTP)
+
+	if rr.Code != http.StatusTeapot {
+		t.Errorf("want code %v, got %v", http.StatusTeapot, rr.Code)
+	}
+	if b := rr.Body.String(); b != "error page for abc" {
+		t.Errorf("body wrong: %#v", b)
+	}
+	if gotErr == nil || gotErr.Error() != "oh noes!" {
+		t.Errorf("wrong error: %v", gotErr)
+	}
+	if !strings.Contains(string(gotStack), "panicy.ServeHTTP") {
+		t.Errorf("wrong stack:\n%s", gotStack)
+	}
+	if len(logged) != 1 {
+		t.Errorf("wrong logged errors: %v", logged)
+	}
+}
+
+func TestRescueErrorHandlerPanic(t *testing.T) {
+	var logged []error
+	h := WithConfig(Config{
+		Log: func(r *http.Request, err error) { logged = append(logged, err) },
+		ErrorHandler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			panic("error page broke")
+		}),
+	})(panicy{})
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("X-Request-Id", "abc")
+	rr := test.HTTP(t, req, h.ServeHTTP)
+
+	if rr.Code != 500 {
+		t.Errorf("want code %v, got %v", 500, rr.Code)
+	}
+	if ct := rr.Header().Get("Content-Type"); ct != "text/plain; charset=utf-8" {
+		t.Errorf("wrong Content-Type: %#v", ct)
+	}
+	want := "Sorry, the server ran into a problem processing this request.\n\nRequest ID: abc"
+	if b := rr.Body.String(); b != want {
+		t.Errorf("body wrong: %#v", b)
+	}
+	if len(logged) != 2 || !strings.Contains(logged[1].Error(), "error page broke") {
+		t.Errorf("wrong logged errors: %v", logged)
+	}
+}
+
+func TestRescueRequestIDMiddleware(t *testing.T) {
+	var rescueID, ctxID string
+	mw := requestIDMiddleware.WithConfig(requestIDMiddleware.Config{Generate: func() string { return "gen" }})(
+		WithConfig(Config{
+			Log: func(r *http.Request, err error) { rescueID = RequestID(r) },
+		})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctxID = requestIDMiddleware.FromContext(r.Context())
+			panic("oh noes")
+		})))
+
+	for _, in := range []string{"abc", "in valid", strings.Repeat("a", 65)} {
+		t.Run(in, func(t *testing.T) {
+			req := &http.Request{Method: "GET", Header: http.Header{"X-Request-Id": {in}}}
+			test.HTTP(t, req, mw.ServeHTTP)
+			if rescueID != ctxID {
+				t.Errorf("different IDs: rescue %q, requestID %q", rescueID, ctxID)
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package rescueMiddleware
+
+import (
+	"bytes"
+	"fmt"
+	"runtime"
+	"strings"
+)
+
+// defaultMaxStackFrames is used if Config.MaxStackFrames is 0.
+const defaultMaxStackFrames = 32
+
+// stack gets the stack trace of the current panic, starting at the frame that
+// called panic() and with at most max frames.
+//
+// This must be called from the deferred function that recovered the panic.
+func stack(max int) []byte {
+	if max <= 0 {
+		max = defaultMaxStackFrames
+	}
+
+	// Get some extra frames for the deferred function and runtime frames we
+	// skip.
+	pc := make([]uintptr, max+16)
+	n := runtime.Callers(2, pc)
+	frames := runtime.CallersFrames(pc[:n])
+
+	var trace []runtime.Frame
+	sawPanic := false
+	for {
+		f, more := frames.Next()
+		switch {
+		case !sawPanic && f.Function == "runtime.gopanic":
+			sawPanic = true
+			trace = trace[:0]
+		// Skip runtime frames of the panic itself, such as runtime.panicmem.
+		case sawPanic && len(trace) == 0 && strings.HasPrefix(f.Function, "runtime."):
+		default:
+			trace = append(trace, f)
+		}
+		if !more {
+			break
+		}
+	}
+
+	buf := new(bytes.Buffer)
+	for i, f := range trace {
+		if i == max {
+			fmt.Fprintf(buf, "...additional frames elided...\n")
+			break
+		}
+		fmt.Fprintf(buf, "%s()\n\t%s:%d\n", f.Function, f.File, f.Line)
+	}
+	return buf.Bytes()
+}
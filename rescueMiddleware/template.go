@@ -0,0 +1,53 @@
+package rescueMiddleware
+
+import (
+	"bytes"
+	htmltemplate "html/template"
+	"io"
+	"net/http"
+	"text/template"
+
+	"github.com/pkg/errors"
+)
+
+// Templates for the error responses. They're executed with TemplateData.
+type Templates struct {
+	// HTML is used for requests that don't want JSON. This takes precedence
+	// over Text.
+	HTML *htmltemplate.Template
+
+	// Text is used for requests that don't want JSON if HTML is nil.
+	Text *template.Template
+
+	// JSON is used for AJAX requests, or if the Accept header prefers JSON.
+	// The output should be valid JSON. text/template doesn't escape anything,
+	// so any fields used should be encoded with a template function which uses
+	// encoding/json.
+	JSON *template.Template
+}
+
+// TemplateData is passed to Templates.
+type TemplateData struct {
+	// HTTP status code of the response.
+	Status int
+
+	// Message is the default error message.
+	Message string
+
+	// RequestID to include in the response, so users can report it.
+	RequestID string
+}
+
+type executer interface {
+	Execute(io.Writer, interface{}) error
+}
+
+// execute the template, returning nil if this fails.
+func (config Config) execute(r *http.Request, tpl executer, data TemplateData) []byte {
+	buf := new(bytes.Buffer)
+	if err := tpl.Execute(buf, data); err != nil {
+		config.Log(r, errors.Wrap(err, "rescueMiddleware: could not execute template"))
+		return nil
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,63 @@
+package rescueMiddleware
+
+import (
+	htmltemplate "html/template"
+	"net/http"
+	"testing"
+	"text/template"
+
+	"github.com/teamwork/test"
+)
+
+func TestTemplates(t *testing.T) {
+	tpl := Templates{
+		HTML: htmltemplate.Must(htmltemplate.New("").Parse(`<p>Fout {{.Status}} ({{.RequestID}})</p>`)),
+		Text: template.Must(template.New("").Parse(`Fout {{.Status}}`)),
+		JSON: template.Must(template.New("").Parse(`{"bericht":"Fout {{.Status}}"}`)),
+	}
+	text := defaultMessage + "\n\nRequest ID: abc"
+
+	cases := []struct {
+		name     string
+		tpl      Templates
+		accept   string
+		wantBody string
+		wantCT   string
+	}{
+		{"html", tpl, "text/html", `<p>Fout 500 (abc)</p>`, "text/html; charset=utf-8"},
+		{"json", tpl, "application/json", `{"bericht":"Fout 500"}`, "application/json"},
+		{"text", Templates{Text: tpl.Text}, "text/html", `Fout 500`, "text/plain; charset=utf-8"},
+		{"default html", Templates{JSON: tpl.JSON}, "text/html", text, ""},
+		{"default json", Templates{HTML: tpl.HTML}, "application/json",
+			`{"message":"Sorry, the server ran into a problem processing this request.","request_id":"abc"}`,
+			"application/json"},
+		{"broken", Templates{Text: template.Must(template.New("").Parse(`{{.Nope}}`))}, "text/html",
+			text, "text/plain; charset=utf-8"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest("GET", "/", nil)
+			if err != nil {
+				t.Fatalf("cannot make request: %v", err)
+			}
+			req.Header.Set("Accept", tc.accept)
+			req.Header.Set("X-Request-Id", "abc")
+
+			rr := test.HTTP(t, req, WithConfig(Config{
+				Log:       func(*http.Request, error) {},
+				Templates: func(*http.Request) Templates { return tc.tpl },
+			})(panicy{}).ServeHTTP)
+
+			if rr.Code != 500 {
+				t.Errorf("want code %v, got %v", 500, rr.Code)
+			}
+			if b := rr.Body.String(); b != tc.wantBody {
+				t.Errorf("body wrong:\nwant: %#v\ngot:  %#v\n", tc.wantBody, b)
+			}
+			if ct := rr.Header().Get("Content-Type"); ct != tc.wantCT {
+				t.Errorf("Content-Type wrong:\nwant: %#v\ngot:  %#v\n", tc.wantCT, ct)
+			}
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package rescueMiddleware
+
+import (
+	"bytes"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Helper function to make it easier to test.
+var now = func() time.Time { return time.Now() }
+
+// maxThrottled is the maximum number of different panics to keep track of;
+// panics beyond that are always logged.
+const maxThrottled = 1000
+
+// throttle limits logging of identical panics.
+type throttle struct {
+	every time.Duration
+
+	mu   sync.Mutex
+	seen map[uint64]*throttleEntry
+}
+
+type throttleEntry struct {
+	logged     time.Time
+	suppressed int
+}
+
+func newThrottle(every time.Duration) *throttle {
+	return &throttle{every: every, seen: make(map[uint64]*throttleEntry)}
+}
+
+// check if the error should be logged. Panics are identical if the error
+// message and the top stack frame are the same.
+//
+// The returned error will include the number of suppressed panics since the
+// last time it was logged.
+func (t *throttle) check(err error, stack []byte) (bool, error) {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(err.Error()))
+	// The first two lines are the function and file:line of the top frame.
+	top := bytes.SplitN(stack, []byte("\n"), 3)
+	if len(top) > 2 {
+		top = top[:2]
+	}
+	_, _ = h.Write(bytes.Join(top, []byte("\n")))
+	sig := h.Sum64()
+
+	n := now()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	log := true
+	e, ok := t.seen[sig]
+	switch {
+	case !ok:
+		if len(t.seen) < maxThrottled {
+			t.seen[sig] = &throttleEntry{logged: n}
+		}
+	case n.Sub(e.logged) < t.every:
+		e.suppressed++
+		log = false
+	default:
+		if e.suppressed > 0 {
+			err = errors.Wrapf(err, "rescueMiddleware: %d identical panics not logged", e.suppressed)
+		}
+		e.logged = n
+		e.suppressed = 0
+	}
+
+	// Remove expired entries to keep memory bounded. Entries with suppressed
+	// panics are kept for one more interval so the count can be reported if
+	// the panic happens again.
+	for k, e := range t.seen {
+		age := n.Sub(e.logged)
+		if age >= 2*t.every || (e.suppressed == 0 && age >= t.every) {
+			delete(t.seen, k)
+		}
+	}
+	return log, err
+}
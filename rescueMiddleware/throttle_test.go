@@ -0,0 +1,103 @@
+package rescueMiddleware
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/teamwork/test"
+)
+
+func TestLogEvery(t *testing.T) {
+	oldNow := now
+	defer func() { now = oldNow }()
+	start := time.Date(2018, 1, 1, 1, 0, 0, 0, time.UTC)
+	now = func() time.Time { return start }
+
+	var logged []string
+	msg := "oh noes!"
+	h := WithConfig(Config{
+		Log:      func(r *http.Request, err error) { logged = append(logged, err.Error()) },
+		LogEvery: time.Minute,
+	})(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		panic(msg)
+	})).ServeHTTP
+
+	for i := 0; i < 5; i++ {
+		rr := test.HTTP(t, nil, h)
+		if rr.Code != 500 {
+			t.Errorf("want code %v, got %v", 500, rr.Code)
+		}
+	}
+	if len(logged) != 1 || logged[0] != "oh noes!" {
+		t.Fatalf("want one log, got %#v", logged)
+	}
+
+	// Different panic is logged.
+	msg = "other"
+	test.HTTP(t, nil, h)
+	if len(logged) != 2 {
+		t.Fatalf("different panic not logged: %#v", logged)
+	}
+
+	msg = "oh noes!"
+	now = func() time.Time { return start.Add(time.Minute) }
+	test.HTTP(t, nil, h)
+	test.HTTP(t, nil, h)
+	want := []string{"oh noes!", "other", "rescueMiddleware: 4 identical panics not logged: oh noes!"}
+	if len(logged) != 3 || logged[2] != want[2] {
+		t.Fatalf("\nout:  %#v\nwant: %#v\n", logged, want)
+	}
+}
+
+func TestThrottleEvict(t *testing.T) {
+	oldNow := now
+	defer func() { now = oldNow }()
+	start := time.Date(2018, 1, 1, 1, 0, 0, 0, time.UTC)
+	now = func() time.Time { return start }
+
+	th := newThrottle(time.Minute)
+	for i := 0; i < 10; i++ {
+		err := fmt.Errorf("panic %d", i)
+		th.check(err, nil)
+		th.check(err, nil)
+	}
+	if len(th.seen) != 10 {
+		t.Fatalf("want 10 entries, got %d", len(th.seen))
+	}
+
+	// Entries with suppressed panics are kept for another interval.
+	now = func() time.Time { return start.Add(time.Minute) }
+	_, err := th.check(errors.New("panic 0"), nil)
+	if want := "rescueMiddleware: 1 identical panics not logged: panic 0"; err.Error() != want {
+		t.Errorf("\nout:  %#v\nwant: %#v\n", err.Error(), want)
+	}
+	if len(th.seen) != 10 {
+		t.Fatalf("want 10 entries, got %d", len(th.seen))
+	}
+
+	now = func() time.Time { return start.Add(2 * time.Minute) }
+	th.check(errors.New("new"), nil)
+	if len(th.seen) != 1 {
+		t.Fatalf("want 1 entry, got %d", len(th.seen))
+	}
+}
+
+func TestThrottleMax(t *testing.T) {
+	th := newThrottle(time.Minute)
+	for i := 0; i < maxThrottled+10; i++ {
+		if log, _ := th.check(fmt.Errorf("panic %d", i), nil); !log {
+			t.Fatalf("panic %d not logged", i)
+		}
+	}
+	if len(th.seen) != maxThrottled {
+		t.Fatalf("want %d entries, got %d", maxThrottled, len(th.seen))
+	}
+
+	// Untracked panics are always logged.
+	if log, _ := th.check(fmt.Errorf("panic %d", maxThrottled+1), nil); !log {
+		t.Error("untracked panic not logged")
+	}
+}
@@ -0,0 +1,41 @@
+package securityMiddleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+var benchCSP = map[string][]string{
+	"default-src": {"'self'"},
+	"script-src":  {"'self'", NoncePlaceholder, "https://static.example.com"},
+	"style-src":   {"'self'", NoncePlaceholder},
+	"img-src":     {"'self'", "data:", "https://images.example.com"},
+	"connect-src": {"'self'", "https://api.example.com"},
+	"report-uri":  {"/csp-report"},
+}
+
+func BenchmarkCSP(b *testing.B) {
+	for _, bc := range []struct {
+		name  string
+		nonce bool
+	}{
+		{"static", false},
+		{"nonce", true},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			config := DefaultConfig
+			config.ContentSecurityPolicy = benchCSP
+			config.ContentSecurityPolicyReportOnly = benchCSP
+			config.CSPNonce = bc.nonce
+			h := WithConfig(config, "example.com")(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+			r := httptest.NewRequest("GET", "/", nil)
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				h.ServeHTTP(httptest.NewRecorder(), r)
+			}
+		})
+	}
+}
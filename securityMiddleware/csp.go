@@ -0,0 +1,245 @@
+package securityMiddleware
+
+import (
+	"fmt"
+	"strings"
+)
+
+// cspDirectives are all known CSP directives.
+var cspDirectives = []string{
+	"base-uri",
+	"block-all-mixed-content",
+	"child-src",
+	"connect-src",
+	"default-src",
+	"font-src",
+	"form-action",
+	"frame-ancestors",
+	"frame-src",
+	"img-src",
+	"manifest-src",
+	"media-src",
+	"navigate-to",
+	"object-src",
+	"plugin-types",
+	"prefetch-src",
+	"report-to",
+	"report-uri",
+	"require-trusted-types-for",
+	"sandbox",
+	"script-src",
+	"script-src-attr",
+	"script-src-elem",
+	"style-src",
+	"style-src-attr",
+	"style-src-elem",
+	"trusted-types",
+	"upgrade-insecure-requests",
+	"worker-src",
+}
+
+// cspKeywords are source expressions that need to be quoted.
+var cspKeywords = []string{
+	"self",
+	"none",
+	"unsafe-inline",
+	"unsafe-eval",
+	"unsafe-hashes",
+	"unsafe-allow-redirects",
+	"strict-dynamic",
+	"report-sample",
+	"wasm-unsafe-eval",
+}
+
+// cspQuotedPrefixes are prefixes of source expressions that need to be quoted.
+var cspQuotedPrefixes = []string{"nonce-", "sha256-", "sha384-", "sha512-"}
+
+// CSPBuilder builds a Content-Security-Policy header value, for use in
+// Config.CSPHeader or Config.CSPReportOnlyHeader.
+//
+// Keywords such as self or unsafe-inline and nonce or hash sources are quoted
+// automatically if they're not quoted already. Directives are added in the
+// order they're first set.
+type CSPBuilder struct {
+	directives []cspDirective
+}
+
+type cspDirective struct {
+	name   string
+	values []string
+}
+
+// NewCSPBuilder creates a new empty CSPBuilder.
+func NewCSPBuilder() *CSPBuilder {
+	return &CSPBuilder{}
+}
+
+// Directive adds values to a directive. Directive names are validated when
+// calling Build().
+func (b *CSPBuilder) Directive(name string, values ...string) *CSPBuilder {
+	for i := range b.directives {
+		if b.directives[i].name == name {
+			b.directives[i].values = append(b.directives[i].values, values...)
+			return b
+		}
+	}
+
+	b.directives = append(b.directives, cspDirective{
+		name:   name,
+		values: append([]string{}, values...),
+	})
+	return b
+}
+
+// DefaultSrc adds sources to the default-src directive.
+func (b *CSPBuilder) DefaultSrc(sources ...string) *CSPBuilder {
+	return b.Directive("default-src", sources...)
+}
+
+// ScriptSrc adds sources to the script-src directive.
+func (b *CSPBuilder) ScriptSrc(sources ...string) *CSPBuilder {
+	return b.Directive("script-src", sources...)
+}
+
+// StyleSrc adds sources to the style-src directive.
+func (b *CSPBuilder) StyleSrc(sources ...string) *CSPBuilder {
+	return b.Directive("style-src", sources...)
+}
+
+// ImgSrc adds sources to the img-src directive.
+func (b *CSPBuilder) ImgSrc(sources ...string) *CSPBuilder {
+	return b.Directive("img-src", sources...)
+}
+
+// ConnectSrc adds sources to the connect-src directive.
+func (b *CSPBuilder) ConnectSrc(sources ...string) *CSPBuilder {
+	return b.Directive("connect-src", sources...)
+}
+
+// FontSrc adds sources to the font-src directive.
+func (b *CSPBuilder) FontSrc(sources ...string) *CSPBuilder {
+	return b.Directive("font-src", sources...)
+}
+
+// ObjectSrc adds sources to the object-src directive.
+func (b *CSPBuilder) ObjectSrc(sources ...string) *CSPBuilder {
+	return b.Directive("object-src", sources...)
+}
+
+// MediaSrc adds sources to the media-src directive.
+func (b *CSPBuilder) MediaSrc(sources ...string) *CSPBuilder {
+	return b.Directive("media-src", sources...)
+}
+
+// FrameSrc adds sources to the frame-src directive.
+func (b *CSPBuilder) FrameSrc(sources ...string) *CSPBuilder {
+	return b.Directive("frame-src", sources...)
+}
+
+// WorkerSrc adds sources to the worker-src directive.
+func (b *CSPBuilder) WorkerSrc(sources ...string) *CSPBuilder {
+	return b.Directive("worker-src", sources...)
+}
+
+// FrameAncestors adds sources to the frame-ancestors directive.
+func (b *CSPBuilder) FrameAncestors(sources ...string) *CSPBuilder {
+	return b.Directive("frame-ancestors", sources...)
+}
+
+// FormAction adds sources to the form-action directive.
+func (b *CSPBuilder) FormAction(sources ...string) *CSPBuilder {
+	return b.Directive("form-action", sources...)
+}
+
+// BaseURI adds sources to the base-uri directive.
+func (b *CSPBuilder) BaseURI(sources ...string) *CSPBuilder {
+	return b.Directive("base-uri", sources...)
+}
+
+// ReportURI adds an URL to the report-uri directive.
+func (b *CSPBuilder) ReportURI(uri string) *CSPBuilder {
+	return b.Directive("report-uri", uri)
+}
+
+// ReportTo sets the Report-To group name to send reports to; see
+// Config.ReportTo.
+func (b *CSPBuilder) ReportTo(group string) *CSPBuilder {
+	return b.Directive("report-to", group)
+}
+
+// UpgradeInsecureRequests adds the upgrade-insecure-requests directive.
+func (b *CSPBuilder) UpgradeInsecureRequests() *CSPBuilder {
+	return b.Directive("upgrade-insecure-requests")
+}
+
+// Build the header value.
+//
+// An error is returned if any of the directive names are unknown, or if any
+// of the values contain control characters, semicolons, or commas.
+func (b *CSPBuilder) Build() (string, error) {
+	csp := ""
+	for _, d := range b.directives {
+		if !inSlice(cspDirectives, d.name) {
+			return "", fmt.Errorf("unknown CSP directive %q", d.name)
+		}
+		if err := validateCSPDirective(d.name, d.values); err != nil {
+			return "", err
+		}
+
+		csp += d.name
+		for _, v := range d.values {
+			csp += " " + quoteSource(v)
+		}
+		csp += "; "
+	}
+	return strings.TrimRight(csp, " "), nil
+}
+
+// quoteSource quotes CSP keywords.
+func quoteSource(s string) string {
+	if strings.HasPrefix(s, "'") {
+		return s
+	}
+	if inSlice(cspKeywords, strings.ToLower(s)) {
+		return "'" + s + "'"
+	}
+	for _, p := range cspQuotedPrefixes {
+		if strings.HasPrefix(s, p) {
+			return "'" + s + "'"
+		}
+	}
+	return s
+}
+
+// validateCSPDirective checks that the directive name and values can't end the
+// directive or policy, or the header.
+func validateCSPDirective(name string, values []string) error {
+	if name == "" || strings.ContainsAny(name, " ;,") || hasControl(name) {
+		return fmt.Errorf("invalid CSP directive name %q", name)
+	}
+	for _, v := range values {
+		if strings.ContainsAny(v, ";,") || hasControl(v) {
+			return fmt.Errorf("invalid CSP value %q for %s", v, name)
+		}
+	}
+	return nil
+}
+
+// validateCSPHeader checks that a pre-built CSP header value doesn't contain
+// control characters.
+func validateCSPHeader(csp string) error {
+	if hasControl(csp) {
+		return fmt.Errorf("invalid CSP header value %q", csp)
+	}
+	return nil
+}
+
+// hasControl reports if s contains ASCII control characters, such as newlines.
+func hasControl(s string) bool {
+	for _, c := range s {
+		if c < 0x20 || c == 0x7f {
+			return true
+		}
+	}
+	return false
+}
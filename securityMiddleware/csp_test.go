@@ -0,0 +1,76 @@
+package securityMiddleware
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/teamwork/test"
+)
+
+func TestCSPBuilder(t *testing.T) {
+	cases := []struct {
+		in      *CSPBuilder
+		want    string
+		wantErr string
+	}{
+		{NewCSPBuilder(), "", ""},
+		{
+			NewCSPBuilder().
+				DefaultSrc("self").
+				ScriptSrc("'self'", "unsafe-inline", "https://static.example.com").
+				ImgSrc("self", "data:").
+				ReportURI("/csp-report"),
+			"default-src 'self'; script-src 'self' 'unsafe-inline' https://static.example.com; " +
+				"img-src 'self' data:; report-uri /csp-report;",
+			"",
+		},
+		{
+			NewCSPBuilder().
+				ScriptSrc("self").
+				StyleSrc("none").
+				ScriptSrc("nonce-abc", "sha256-xyz", NoncePlaceholder).
+				UpgradeInsecureRequests(),
+			"script-src 'self' 'nonce-abc' 'sha256-xyz' $NONCE; style-src 'none'; upgrade-insecure-requests;",
+			"",
+		},
+		{NewCSPBuilder().Directive("defualt-src", "self"), "", `unknown CSP directive "defualt-src"`},
+		{NewCSPBuilder().ScriptSrc("self; img-src *"), "", `invalid CSP value "self; img-src *" for script-src`},
+		{NewCSPBuilder().ImgSrc("*\r\nX-Foo: bar"), "", `invalid CSP value "*\r\nX-Foo: bar" for img-src`},
+		{NewCSPBuilder().ReportURI("/csp,report"), "", `invalid CSP value "/csp,report" for report-uri`},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.want, func(t *testing.T) {
+			out, err := tc.in.Build()
+			if !test.ErrorContains(err, tc.wantErr) {
+				t.Fatalf("wrong error\nout:  %v\nwant: %v\n", err, tc.wantErr)
+			}
+			if out != tc.want {
+				t.Errorf("\nout:  %#v\nwant: %#v\n", out, tc.want)
+			}
+		})
+	}
+}
+
+func TestCSPHeader(t *testing.T) {
+	csp, err := NewCSPBuilder().DefaultSrc("self").Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := test.HTTP(t, &http.Request{Host: "example.com"}, WithConfig(Config{
+		CSPHeader: csp,
+		ContentSecurityPolicy: map[string][]string{
+			"default-src": []string{"'none'"},
+		},
+		CSPReportOnlyHeader: csp,
+	}, "example.com")(handle{}).ServeHTTP)
+
+	want := "default-src 'self';"
+	if h := rr.Header().Get("Content-Security-Policy"); h != want {
+		t.Errorf("\nout:  %#v\nwant: %#v\n", h, want)
+	}
+	if h := rr.Header().Get("Content-Security-Policy-Report-Only"); h != want {
+		t.Errorf("\nout:  %#v\nwant: %#v\n", h, want)
+	}
+}
@@ -0,0 +1,73 @@
+package securityMiddleware
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// NoncePlaceholder is replaced with 'nonce-<value>' in the script-src and
+// style-src CSP directives if Config.CSPNonce is set.
+const NoncePlaceholder = "$NONCE"
+
+// nonceMarker is used in place of the nonce in pre-built headers. It contains
+// control characters, which aren't allowed in the config, so it can't clash
+// with anything else in the header.
+const nonceMarker = "\x00nonce\x00"
+
+// nonceDirectives are the CSP directives in which NoncePlaceholder is
+// replaced.
+var nonceDirectives = []string{
+	"script-src", "script-src-elem",
+	"style-src", "style-src-elem",
+}
+
+type contextKey int
+
+const nonceKey contextKey = 0
+
+// Nonce gets the CSP nonce for this request, for use in the nonce attribute of
+// inline <script> and <style> tags.
+//
+// It will return an empty string if Config.CSPNonce isn't enabled.
+func Nonce(r *http.Request) string {
+	n, _ := r.Context().Value(nonceKey).(string)
+	return n
+}
+
+func withNonce(r *http.Request, nonce string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), nonceKey, nonce))
+}
+
+// newNonce generates 16 random bytes, base64-encoded.
+func newNonce() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Errorf("securityMiddleware: cannot generate nonce: %v", err))
+	}
+	return base64.StdEncoding.EncodeToString(b)
+}
+
+// replaceNonce returns a copy of the CSP policy with NoncePlaceholder replaced.
+func replaceNonce(policy map[string][]string, nonce string) map[string][]string {
+	if len(policy) == 0 || nonce == "" {
+		return policy
+	}
+
+	n := make(map[string][]string, len(policy))
+	for k, v := range policy {
+		if !inSlice(nonceDirectives, k) {
+			n[k] = v
+			continue
+		}
+
+		n[k] = make([]string, len(v))
+		for i := range v {
+			n[k][i] = strings.Replace(v[i], NoncePlaceholder, "'nonce-"+nonce+"'", -1)
+		}
+	}
+	return n
+}
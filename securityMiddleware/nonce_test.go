@@ -0,0 +1,100 @@
+package securityMiddleware
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/teamwork/test"
+)
+
+func TestNonce(t *testing.T) {
+	var nonces []string
+	h := WithConfig(Config{
+		CSPNonce: true,
+		ContentSecurityPolicy: map[string][]string{
+			"default-src": []string{"'self'", NoncePlaceholder},
+			"script-src":  []string{"'self'", NoncePlaceholder},
+			"style-src":   []string{NoncePlaceholder},
+		},
+	}, "example.com")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		nonces = append(nonces, Nonce(r))
+	}))
+
+	var headers []string
+	for i := 0; i < 2; i++ {
+		rr := test.HTTP(t, &http.Request{Host: "example.com"}, h.ServeHTTP)
+		headers = append(headers, rr.Header().Get("Content-Security-Policy"))
+	}
+
+	if nonces[0] == "" || nonces[1] == "" {
+		t.Fatalf("empty nonce: %#v", nonces)
+	}
+	if nonces[0] == nonces[1] {
+		t.Errorf("nonce not regenerated: %#v", nonces)
+	}
+
+	for i := range nonces {
+		want := "default-src 'self' $NONCE; " +
+			"script-src 'self' 'nonce-" + nonces[i] + "'; " +
+			"style-src 'nonce-" + nonces[i] + "';"
+		if headers[i] != want {
+			t.Errorf("\nout:  %#v\nwant: %#v\n", headers[i], want)
+		}
+	}
+}
+
+func TestNonceDisabled(t *testing.T) {
+	var nonce string
+	h := WithConfig(Config{
+		ContentSecurityPolicy: map[string][]string{
+			"script-src": []string{NoncePlaceholder},
+		},
+	}, "example.com")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		nonce = Nonce(r)
+	}))
+
+	rr := test.HTTP(t, &http.Request{Host: "example.com"}, h.ServeHTTP)
+	if nonce != "" {
+		t.Errorf("nonce set: %#v", nonce)
+	}
+	if h := rr.Header().Get("Content-Security-Policy"); strings.Contains(h, "nonce-") {
+		t.Errorf("nonce in header: %#v", h)
+	}
+}
+
+func TestNonceCache(t *testing.T) {
+	cases := []Config{
+		{CSPNonce: true, ContentSecurityPolicy: benchCSP},
+		{CSPNonce: true, ContentSecurityPolicyReportOnly: benchCSP},
+		{CSPNonce: true, ContentSecurityPolicy: map[string][]string{
+			"default-src": {NoncePlaceholder},
+			"script-src":  {NoncePlaceholder, NoncePlaceholder},
+		}},
+		{CSPNonce: true, CSPHeader: "default-src $NONCE; script-src 'self' $NONCE;",
+			CSPReportOnlyHeader: "style-src $NONCE;"},
+		{CSPNonce: true, ContentSecurityPolicy: benchCSP,
+			XFrameOptions: "ALLOW-FROM https://example.com/", FrameAncestorsFromXFrameOptions: true},
+		{CSPNonce: true},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%v", i), func(t *testing.T) {
+			p, err := newPolicy(tc, "example.com", true)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			nonce := newNonce()
+			csp, cspReport := p.cspWithNonce(nonce)
+			wantCSP, wantCSPReport := tc.csp(nonce)
+			if csp != wantCSP {
+				t.Errorf("CSP\nout:  %q\nwant: %q", csp, wantCSP)
+			}
+			if cspReport != wantCSPReport {
+				t.Errorf("CSP-Report-Only\nout:  %q\nwant: %q", cspReport, wantCSPReport)
+			}
+		})
+	}
+}
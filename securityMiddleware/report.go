@@ -0,0 +1,68 @@
+package securityMiddleware
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ReportGroup is a Reporting API endpoint group for the Report-To header. CSP
+// can send reports to the group with the report-to directive; you probably
+// want to keep report-uri as well for browsers that don't support it yet.
+//
+// https://developer.mozilla.org/en-US/docs/Web/HTTP/Headers/Content-Security-Policy/report-to
+type ReportGroup struct {
+	// Group name; the Reporting API uses "default" if this is empty.
+	Group string
+
+	// MaxAge is how long browsers should remember this group.
+	MaxAge time.Duration
+
+	// Endpoints are the URLs to send reports to.
+	Endpoints []string
+
+	// IncludeSubdomains applies the group to all subdomains as well.
+	IncludeSubdomains bool
+}
+
+type reportGroupJSON struct {
+	Group             string               `json:"group,omitempty"`
+	MaxAge            int64                `json:"max_age"`
+	Endpoints         []reportEndpointJSON `json:"endpoints"`
+	IncludeSubdomains bool                 `json:"include_subdomains,omitempty"`
+}
+
+type reportEndpointJSON struct {
+	URL string `json:"url"`
+}
+
+func (g ReportGroup) validate() error {
+	if len(g.Endpoints) == 0 {
+		return fmt.Errorf("no endpoints for Report-To group %q", g.Group)
+	}
+	if g.MaxAge < 0 {
+		return fmt.Errorf("negative max-age %v for Report-To group %q", g.MaxAge, g.Group)
+	}
+	return nil
+}
+
+// buildReportTo builds the header value for a list of Report-To groups.
+func buildReportTo(groups []ReportGroup) string {
+	out := make([]string, 0, len(groups))
+	for _, g := range groups {
+		j := reportGroupJSON{
+			Group:             g.Group,
+			MaxAge:            int64(g.MaxAge / time.Second),
+			Endpoints:         make([]reportEndpointJSON, len(g.Endpoints)),
+			IncludeSubdomains: g.IncludeSubdomains,
+		}
+		for i := range g.Endpoints {
+			j.Endpoints[i].URL = g.Endpoints[i]
+		}
+
+		b, _ := json.Marshal(j)
+		out = append(out, string(b))
+	}
+	return strings.Join(out, ", ")
+}
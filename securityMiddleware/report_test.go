@@ -0,0 +1,86 @@
+package securityMiddleware
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/teamwork/test"
+)
+
+func TestReportTo(t *testing.T) {
+	cases := []struct {
+		in   []ReportGroup
+		want string
+	}{
+		{nil, ""},
+		{
+			[]ReportGroup{{
+				Group:     "csp-endpoint",
+				MaxAge:    126 * 24 * time.Hour,
+				Endpoints: []string{"https://example.com/csp-reports"},
+			}},
+			`{"group":"csp-endpoint","max_age":10886400,"endpoints":[{"url":"https://example.com/csp-reports"}]}`,
+		},
+		{
+			[]ReportGroup{
+				{
+					MaxAge:            time.Hour,
+					Endpoints:         []string{"https://a.example.com/r", "https://b.example.com/r"},
+					IncludeSubdomains: true,
+				},
+				{
+					Group:     "other",
+					MaxAge:    time.Minute,
+					Endpoints: []string{"https://example.com/other"},
+				},
+			},
+			`{"max_age":3600,"endpoints":[{"url":"https://a.example.com/r"},{"url":"https://b.example.com/r"}],` +
+				`"include_subdomains":true}, ` +
+				`{"group":"other","max_age":60,"endpoints":[{"url":"https://example.com/other"}]}`,
+		},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%v", i), func(t *testing.T) {
+			rr := test.HTTP(t, &http.Request{Host: "example.com"},
+				WithConfig(Config{ReportTo: tc.in}, "example.com")(handle{}).ServeHTTP)
+
+			if h := rr.Header().Get("Report-To"); h != tc.want {
+				t.Errorf("\nout:  %#v\nwant: %#v\n", h, tc.want)
+			}
+		})
+	}
+}
+
+func TestReportToCSP(t *testing.T) {
+	csp, err := NewCSPBuilder().
+		DefaultSrc("self").
+		ReportURI("https://example.com/csp-reports").
+		ReportTo("csp-endpoint").
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "default-src 'self'; report-uri https://example.com/csp-reports; report-to csp-endpoint;"
+	if csp != want {
+		t.Errorf("\nout:  %#v\nwant: %#v\n", csp, want)
+	}
+}
+
+func TestReportToInvalid(t *testing.T) {
+	cases := [][]ReportGroup{
+		{{Group: "x", MaxAge: time.Hour}},
+		{{Group: "x", MaxAge: -time.Hour, Endpoints: []string{"https://example.com"}}},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%v", i), func(t *testing.T) {
+			if _, err := New(Config{ReportTo: tc}, "example.com"); err == nil {
+				t.Errorf("no error for %#v", tc)
+			}
+		})
+	}
+}
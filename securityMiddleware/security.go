@@ -3,12 +3,21 @@ package securityMiddleware // import "github.com/teamwork/middleware/securityMid
 
 import (
 	"fmt"
+	"net"
 	"net/http"
+	"net/url"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 )
 
 // Config defines the config for Security middleware.
 type Config struct {
+	// Skipper skips the middleware for a request if it returns true; no
+	// headers will be set at all.
+	Skipper func(*http.Request) bool
+
 	// XFrameOptions controls where this site can be displayed in a frame.
 	//
 	// DENY
@@ -19,16 +28,35 @@ type Config struct {
 	//     page itself.
 	// ALLOW-FROM uri
 	//     The page can only be displayed in a frame on the specified origin.
+	//     This is deprecated and ignored by most browsers; use
+	//     FrameAncestorsFromXFrameOptions or the frame-ancestors CSP
+	//     directive.
 	//
 	// https://developer.mozilla.org/en-US/docs/Web/HTTP/Headers/X-Frame-Options
 	XFrameOptions string
 
+	// FrameAncestorsFromXFrameOptions adds a frame-ancestors directive to the
+	// Content-Security-Policy if XFrameOptions is "ALLOW-FROM uri", so that
+	// modern browsers will allow framing from the same URI. It won't be added
+	// if the CSP already has a frame-ancestors directive.
+	FrameAncestorsFromXFrameOptions bool
+
 	// StrictTransportSecurity makes sure that browsers only communicate over
-	// https. It will only be set if the host matches the root domain.
+	// https. It will only be set if the host matches the root domain or one of
+	// HSTSHosts.
 	//
 	// https://developer.mozilla.org/en-US/docs/Web/HTTP/Headers/Strict-Transport-Security
 	StrictTransportSecurity string
 
+	// HSTS is a structured alternative to StrictTransportSecurity; it takes
+	// precedence if both are set.
+	HSTS *HSTS
+
+	// HSTSHosts is a list of additional hosts that will get the
+	// Strict-Transport-Security header, for example custom domains. A leading
+	// "*." matches all subdomains (but not the domain itself).
+	HSTSHosts []string
+
 	// XContentTypeOptions makes sure that browsers don't auto-guess the
 	// Content-Type, preventing certain attacks.
 	//
@@ -45,6 +73,153 @@ type Config struct {
 	// violations and doesn't block anything, which is useful for testing new
 	// policies.
 	ContentSecurityPolicyReportOnly map[string][]string
+
+	// CSPHeader is a pre-built CSP header value, such as one returned by
+	// CSPBuilder.Build(). It takes precedence over ContentSecurityPolicy.
+	CSPHeader string
+
+	// CSPReportOnlyHeader is a pre-built CSP-Report-Only header value. It takes
+	// precedence over ContentSecurityPolicyReportOnly.
+	CSPReportOnlyHeader string
+
+	// CSPNonce generates a new random nonce for every request, which replaces
+	// NoncePlaceholder in the script-src and style-src directives of both CSP
+	// headers (or anywhere in CSPHeader and CSPReportOnlyHeader). Handlers can
+	// get the nonce with Nonce().
+	//
+	// https://developer.mozilla.org/en-US/docs/Web/HTML/Global_attributes/nonce
+	CSPNonce bool
+
+	// ReportTo sets the Report-To header, which defines the endpoint groups
+	// that can be used in the CSP report-to directive.
+	//
+	// https://developer.mozilla.org/en-US/docs/Web/HTTP/Headers/Content-Security-Policy/report-to
+	ReportTo []ReportGroup
+
+	// ReferrerPolicy controls how much referrer information is sent with
+	// requests. Multiple comma-separated values can be given as a fallback for
+	// browsers that don't support the last one.
+	//
+	// https://developer.mozilla.org/en-US/docs/Web/HTTP/Headers/Referrer-Policy
+	ReferrerPolicy string
+
+	// PermissionsPolicy controls which browser features (such as geolocation
+	// or camera) can be used. The key is the feature name and the value the
+	// list of allowed origins; an empty list disables the feature completely.
+	//
+	// The keywords self, src, and * are added as-is, any other origin will be
+	// quoted.
+	//
+	// https://developer.mozilla.org/en-US/docs/Web/HTTP/Headers/Permissions-Policy
+	PermissionsPolicy map[string][]string
+
+	// CrossOriginOpenerPolicy controls whether a top-level document shares a
+	// browsing context group with cross-origin documents, e.g. "same-origin".
+	//
+	// https://developer.mozilla.org/en-US/docs/Web/HTTP/Headers/Cross-Origin-Opener-Policy
+	CrossOriginOpenerPolicy string
+
+	// CrossOriginEmbedderPolicy controls whether cross-origin resources that
+	// don't explicitly grant permission can be loaded, e.g. "require-corp".
+	//
+	// Together with CrossOriginOpenerPolicy this enables cross-origin
+	// isolation, which is needed for e.g. SharedArrayBuffer.
+	//
+	// https://developer.mozilla.org/en-US/docs/Web/HTTP/Headers/Cross-Origin-Embedder-Policy
+	CrossOriginEmbedderPolicy string
+
+	// CrossOriginResourcePolicy controls which origins can load this resource,
+	// e.g. "same-site".
+	//
+	// https://developer.mozilla.org/en-US/docs/Web/HTTP/Headers/Cross-Origin-Resource-Policy
+	CrossOriginResourcePolicy string
+
+	// XPermittedCrossDomainPolicies controls if Adobe Flash and Acrobat can
+	// load data from this site with cross-domain policy files, e.g. "none".
+	//
+	// https://owasp.org/www-project-secure-headers/#x-permitted-cross-domain-policies
+	XPermittedCrossDomainPolicies string
+
+	// XDownloadOptions stops Internet Explorer from opening downloads in the
+	// context of the site if set to "noopen".
+	XDownloadOptions string
+
+	// ClearSiteData tells browsers to clear data for this site, which is
+	// useful on logout. The function returns the data types to clear for a
+	// request ("cache", "cookies", "storage", "executionContexts", or "*"). The
+	// header isn't sent if it returns nothing.
+	//
+	// https://developer.mozilla.org/en-US/docs/Web/HTTP/Headers/Clear-Site-Data
+	ClearSiteData func(*http.Request) []string
+
+	// ServerHeader overrides the Server header, which can leak details about
+	// the software running on the server. Use RemoveServerHeader to remove it
+	// altogether.
+	//
+	// This is applied just before the response is sent, so it also covers
+	// headers set by the handler.
+	ServerHeader string
+
+	// CacheControl sets the Cache-Control header, to prevent intermediaries
+	// from caching sensitive responses.
+	//
+	// This is applied just before the response is sent, and only if the
+	// handler didn't set a Cache-Control header; so handlers for e.g. static
+	// assets can still set their own.
+	CacheControl string
+
+	// NoStore is a shortcut for setting CacheControl to
+	// "no-store, no-cache, must-revalidate" and also sets "Pragma: no-cache"
+	// for HTTP/1.0 caches. CacheControl takes precedence if both are set.
+	NoStore bool
+
+	// DontOverride only sets the headers if the handler didn't set them, for
+	// example so a handler for an embeddable page can use a different
+	// X-Frame-Options. The headers are set just before the response is
+	// written, instead of before calling the handler.
+	DontOverride bool
+}
+
+// RemoveServerHeader can be used as Config.ServerHeader to remove the Server
+// header.
+const RemoveServerHeader = "-"
+
+// HSTS configures the Strict-Transport-Security header.
+type HSTS struct {
+	// MaxAge is how long browsers should remember to only use https; this is
+	// rounded down to whole seconds.
+	MaxAge time.Duration
+
+	// IncludeSubDomains applies the rule to all subdomains as well.
+	IncludeSubDomains bool
+
+	// Preload allows the domain to be included in browsers' preload lists.
+	// Browsers will reject this unless IncludeSubDomains is also set.
+	Preload bool
+}
+
+// String gets the header value, e.g. "max-age=15552000; includeSubDomains".
+func (h HSTS) String() string {
+	s := fmt.Sprintf("max-age=%d", int64(h.MaxAge/time.Second))
+	if h.IncludeSubDomains {
+		s += "; includeSubDomains"
+	}
+	if h.Preload {
+		s += "; preload"
+	}
+	return s
+}
+
+// referrerPolicies are all valid Referrer-Policy tokens.
+var referrerPolicies = []string{
+	"no-referrer",
+	"no-referrer-when-downgrade",
+	"origin",
+	"origin-when-cross-origin",
+	"same-origin",
+	"strict-origin",
+	"strict-origin-when-cross-origin",
+	"unsafe-url",
 }
 
 // DefaultConfig is the default Security middleware config.
@@ -52,44 +227,449 @@ var DefaultConfig = Config{
 	XFrameOptions:           "SAMEORIGIN",      // Allow displaying in frame only on same domain
 	StrictTransportSecurity: "max-age=2592000", // Only allow http for the next 30 days
 	XContentTypeOptions:     true,              // Block CSS/JS files without correct Content-Type
+	ReferrerPolicy:          "strict-origin-when-cross-origin",
+
+	XPermittedCrossDomainPolicies: "none",
+	XDownloadOptions:              "noopen",
+}
+
+// validate the config.
+//
+// The X-Frame-Options and CSP values are only checked if strict is set, as
+// WithConfig has always used them as-is.
+func (config Config) validate(strict bool) error {
+	if strict {
+		if err := config.validateStrict(); err != nil {
+			return err
+		}
+	}
+	if config.HSTS != nil {
+		if config.HSTS.MaxAge < 0 {
+			return fmt.Errorf("negative HSTS max-age %v", config.HSTS.MaxAge)
+		}
+		if config.HSTS.Preload && !config.HSTS.IncludeSubDomains {
+			return fmt.Errorf("HSTS preload requires includeSubDomains")
+		}
+	}
+	for _, g := range config.ReportTo {
+		if err := g.validate(); err != nil {
+			return err
+		}
+	}
+	if config.ReferrerPolicy != "" {
+		for _, p := range strings.Split(config.ReferrerPolicy, ",") {
+			if !inSlice(referrerPolicies, strings.ToLower(strings.TrimSpace(p))) {
+				return fmt.Errorf("unknown Referrer-Policy value %q", p)
+			}
+		}
+	}
+	return nil
+}
+
+// validateStrict checks the X-Frame-Options and CSP values.
+func (config Config) validateStrict() error {
+	if config.XFrameOptions != "" {
+		if _, err := allowFrom(config.XFrameOptions); err != nil {
+			return err
+		}
+	}
+	for _, policy := range []map[string][]string{
+		config.ContentSecurityPolicy, config.ContentSecurityPolicyReportOnly,
+	} {
+		for name, values := range policy {
+			if err := validateCSPDirective(name, values); err != nil {
+				return err
+			}
+		}
+	}
+	for _, csp := range []string{config.CSPHeader, config.CSPReportOnlyHeader} {
+		if err := validateCSPHeader(csp); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// allowFrom validates the X-Frame-Options value, returning the URI for
+// ALLOW-FROM values.
+func allowFrom(xfo string) (string, error) {
+	f := strings.Fields(xfo)
+	switch {
+	case len(f) == 1 && (strings.EqualFold(f[0], "DENY") || strings.EqualFold(f[0], "SAMEORIGIN")):
+		return "", nil
+	case len(f) == 2 && strings.EqualFold(f[0], "ALLOW-FROM"):
+		u, err := url.Parse(f[1])
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return "", fmt.Errorf("invalid X-Frame-Options ALLOW-FROM URI %q", f[1])
+		}
+		// It's also used for frame-ancestors.
+		if err := validateCSPDirective("frame-ancestors", f[1:]); err != nil {
+			return "", err
+		}
+		return f[1], nil
+	default:
+		return "", fmt.Errorf("invalid X-Frame-Options value %q", xfo)
+	}
 }
 
 // WithConfig returns a Security middleware from config.
+//
+// It will panic if the config contains invalid values, such as a negative HSTS
+// max-age. The X-Frame-Options and CSP values are used as-is; use New() to
+// validate them too, and to get an error instead of a panic.
 func WithConfig(config Config, rootDomain string) func(http.Handler) http.Handler {
-	// Avoid looping over the map on every request.
-	csp := ""
-	for k, v := range config.ContentSecurityPolicy {
-		csp += fmt.Sprintf("%v %v; ", k, strings.Join(v, " "))
+	p, err := newPolicy(config, rootDomain, false)
+	if err != nil {
+		panic(err)
+	}
+	return p.middleware
+}
+
+// New returns a Security middleware from config, or an error if the config
+// contains invalid values.
+//
+// Unlike WithConfig, the X-Frame-Options value must be DENY, SAMEORIGIN, or
+// ALLOW-FROM with an absolute URI, and the CSP values can't contain control
+// characters or anything else that ends the directive or policy.
+func New(config Config, rootDomain string) (func(http.Handler) http.Handler, error) {
+	p, err := newPolicy(config, rootDomain, true)
+	if err != nil {
+		return nil, err
 	}
-	csp = strings.TrimRight(csp, " ")
+	return p.middleware, nil
+}
+
+func (p *policy) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p.serve(w, r, next)
+	})
+}
+
+// WithConfigFunc returns a Security middleware which gets the config for every
+// request from configFunc, for example to use a different config for every
+// host. DefaultConfig is used if configFunc returns nil.
+//
+// The headers are built once for every *Config pointer and cached, so
+// configFunc must return long-lived pointers (e.g. from a fixed set of configs)
+// which aren't modified after they're first returned; returning a new pointer
+// for every request will build the headers on every request. It will panic on
+// every request that uses a config which New() would reject.
+func WithConfigFunc(configFunc func(*http.Request) *Config, rootDomain string) func(http.Handler) http.Handler {
+	return withConfigFunc(configFunc, rootDomain, &policyCache{})
+}
 
-	cspReport := ""
-	for k, v := range config.ContentSecurityPolicyReportOnly {
-		cspReport += fmt.Sprintf("%v %v; ", k, strings.Join(v, " "))
+func withConfigFunc(configFunc func(*http.Request) *Config, rootDomain string, cache *policyCache) func(http.Handler) http.Handler {
+	def, err := newPolicy(DefaultConfig, rootDomain, true)
+	if err != nil {
+		panic(err)
 	}
-	cspReport = strings.TrimRight(cspReport, " ")
 
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-
-			if config.XFrameOptions != "" {
-				w.Header().Set("X-Frame-Options", config.XFrameOptions)
-			}
-			if csp != "" {
-				w.Header().Set("Content-Security-Policy", csp)
+			config := configFunc(r)
+			if config == nil {
+				def.serve(w, r, next)
+				return
 			}
-			if cspReport != "" {
-				w.Header().Set("Content-Security-Policy-Report-Only", cspReport)
+
+			cp := cache.get(config, rootDomain)
+			if cp.err != nil {
+				panic(cp.err)
 			}
-			if config.StrictTransportSecurity != "" &&
-				strings.HasSuffix(r.Host, rootDomain) {
-				w.Header().Set("Strict-Transport-Security", config.StrictTransportSecurity)
+			cp.p.serve(w, r, next)
+		})
+	}
+}
+
+// maxCachedPolicies is the maximum number of configs WithConfigFunc keeps the
+// built policies for; the cache is cleared when it's full.
+const maxCachedPolicies = 256
+
+// policyCache keeps the policies for the configs from WithConfigFunc.
+type policyCache struct {
+	mu sync.Mutex
+	m  map[*Config]cachedPolicy
+}
+
+// cachedPolicy is the result of newPolicy for a config from WithConfigFunc.
+type cachedPolicy struct {
+	p   *policy
+	err error
+}
+
+func (c *policyCache) get(config *Config, rootDomain string) cachedPolicy {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if cp, ok := c.m[config]; ok {
+		return cp
+	}
+	if c.m == nil || len(c.m) >= maxCachedPolicies {
+		c.m = make(map[*Config]cachedPolicy)
+	}
+	p, err := newPolicy(*config, rootDomain, true)
+	cp := cachedPolicy{p, err}
+	c.m[config] = cp
+	return cp
+}
+
+// policy is a validated config with the header values built.
+type policy struct {
+	config     Config
+	rootDomain string
+
+	csp, cspReport, permissions, reportTo, hsts string
+}
+
+func newPolicy(config Config, rootDomain string, strict bool) (*policy, error) {
+	if err := config.validate(strict); err != nil {
+		return nil, fmt.Errorf("securityMiddleware: %v", err)
+	}
+
+	p := &policy{
+		config:      config,
+		rootDomain:  rootDomain,
+		permissions: buildPermissions(config.PermissionsPolicy),
+		reportTo:    buildReportTo(config.ReportTo),
+		hsts:        config.StrictTransportSecurity,
+	}
+	if config.CSPNonce {
+		// Build the headers once with a marker, which is replaced with the
+		// nonce on every request.
+		p.csp, p.cspReport = config.csp(nonceMarker)
+	} else {
+		p.csp, p.cspReport = config.csp("")
+	}
+	if config.HSTS != nil {
+		p.hsts = config.HSTS.String()
+	}
+	return p, nil
+}
+
+// serve sets the headers and calls next.
+func (p *policy) serve(w http.ResponseWriter, r *http.Request, next http.Handler) {
+	config := p.config
+	if config.Skipper != nil && config.Skipper(r) {
+		next.ServeHTTP(w, r)
+		return
+	}
+
+	csp, cspReport := p.csp, p.cspReport
+	if config.CSPNonce {
+		nonce := newNonce()
+		r = withNonce(r, nonce)
+		csp, cspReport = p.cspWithNonce(nonce)
+	}
+
+	// With DontOverride the headers are set in beforeWrite.
+	h := w.Header()
+	var defaults http.Header
+	if config.DontOverride {
+		defaults = make(http.Header)
+		h = defaults
+	}
+
+	if config.XFrameOptions != "" {
+		h.Set("X-Frame-Options", config.XFrameOptions)
+	}
+	if csp != "" {
+		h.Set("Content-Security-Policy", csp)
+	}
+	if cspReport != "" {
+		h.Set("Content-Security-Policy-Report-Only", cspReport)
+	}
+	if p.reportTo != "" {
+		h.Set("Report-To", p.reportTo)
+	}
+	if p.hsts != "" && (strings.HasSuffix(r.Host, p.rootDomain) ||
+		matchHosts(config.HSTSHosts, r.Host)) {
+		h.Set("Strict-Transport-Security", p.hsts)
+	}
+	if config.XContentTypeOptions {
+		h.Set("X-Content-Type-Options", "nosniff")
+	}
+	if config.ReferrerPolicy != "" {
+		h.Set("Referrer-Policy", config.ReferrerPolicy)
+	}
+	if p.permissions != "" {
+		h.Set("Permissions-Policy", p.permissions)
+	}
+	if config.CrossOriginOpenerPolicy != "" {
+		h.Set("Cross-Origin-Opener-Policy", config.CrossOriginOpenerPolicy)
+	}
+	if config.CrossOriginEmbedderPolicy != "" {
+		h.Set("Cross-Origin-Embedder-Policy", config.CrossOriginEmbedderPolicy)
+	}
+	if config.CrossOriginResourcePolicy != "" {
+		h.Set("Cross-Origin-Resource-Policy", config.CrossOriginResourcePolicy)
+	}
+	if config.XPermittedCrossDomainPolicies != "" {
+		h.Set("X-Permitted-Cross-Domain-Policies", config.XPermittedCrossDomainPolicies)
+	}
+	if config.XDownloadOptions != "" {
+		h.Set("X-Download-Options", config.XDownloadOptions)
+	}
+	if config.ClearSiteData != nil {
+		if types := config.ClearSiteData(r); len(types) > 0 {
+			h.Set("Clear-Site-Data", buildClearSiteData(types))
+		}
+	}
+
+	if config.ServerHeader == "" && config.CacheControl == "" && !config.NoStore &&
+		!config.DontOverride {
+		next.ServeHTTP(w, r)
+		return
+	}
+
+	rw := &responseWriter{ResponseWriter: w, beforeWrite: func(h http.Header) {
+		p.beforeWrite(h, defaults)
+	}}
+	// Deferred so the headers are also set on the error page if the handler
+	// panics and a middleware before this one recovers it.
+	defer rw.finish()
+	next.ServeHTTP(rw, r)
+}
+
+// beforeWrite sets the headers that need to be set after the handler ran, and
+// any defaults that the handler didn't set.
+func (p *policy) beforeWrite(h, defaults http.Header) {
+	for k, v := range defaults {
+		if h.Get(k) == "" {
+			h[k] = v
+		}
+	}
+
+	switch p.config.ServerHeader {
+	case "":
+	case RemoveServerHeader:
+		h.Del("Server")
+	default:
+		h.Set("Server", p.config.ServerHeader)
+	}
+
+	if h.Get("Cache-Control") == "" {
+		switch {
+		case p.config.CacheControl != "":
+			h.Set("Cache-Control", p.config.CacheControl)
+		case p.config.NoStore:
+			h.Set("Cache-Control", "no-store, no-cache, must-revalidate")
+			h.Set("Pragma", "no-cache")
+		}
+	}
+}
+
+// cspWithNonce gets the CSP and CSP-Report-Only header values with the nonce
+// marker replaced.
+func (p *policy) cspWithNonce(nonce string) (csp, cspReport string) {
+	return strings.Replace(p.csp, nonceMarker, nonce, -1),
+		strings.Replace(p.cspReport, nonceMarker, nonce, -1)
+}
+
+// csp gets the CSP and CSP-Report-Only header values, with NoncePlaceholder
+// replaced if nonce isn't empty.
+func (config Config) csp(nonce string) (csp, cspReport string) {
+	csp = config.CSPHeader
+	if csp == "" {
+		csp = buildCSP(replaceNonce(config.ContentSecurityPolicy, nonce))
+	} else if nonce != "" {
+		csp = strings.Replace(csp, NoncePlaceholder, "'nonce-"+nonce+"'", -1)
+	}
+	if config.FrameAncestorsFromXFrameOptions && !strings.Contains(csp, "frame-ancestors") {
+		if uri, _ := allowFrom(config.XFrameOptions); uri != "" {
+			csp = strings.TrimLeft(csp+" frame-ancestors "+uri+";", " ")
+		}
+	}
+
+	cspReport = config.CSPReportOnlyHeader
+	if cspReport == "" {
+		cspReport = buildCSP(replaceNonce(config.ContentSecurityPolicyReportOnly, nonce))
+	} else if nonce != "" {
+		cspReport = strings.Replace(cspReport, NoncePlaceholder, "'nonce-"+nonce+"'", -1)
+	}
+	return csp, cspReport
+}
+
+// buildCSP builds the header value for a CSP directive map. The directives are
+// sorted by name so the header is always the same for the same config.
+func buildCSP(policy map[string][]string) string {
+	keys := make([]string, 0, len(policy))
+	for k := range policy {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	csp := ""
+	for _, k := range keys {
+		csp += fmt.Sprintf("%v %v; ", k, strings.Join(policy[k], " "))
+	}
+	return strings.TrimRight(csp, " ")
+}
+
+// buildPermissions builds the header value for a Permissions-Policy map, sorted
+// by feature name.
+func buildPermissions(policy map[string][]string) string {
+	keys := make([]string, 0, len(policy))
+	for k := range policy {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	features := make([]string, 0, len(keys))
+	for _, k := range keys {
+		allow := make([]string, 0, len(policy[k]))
+		for _, o := range policy[k] {
+			switch {
+			case o == "self" || o == "src" || o == "*" || strings.HasPrefix(o, `"`):
+				allow = append(allow, o)
+			default:
+				allow = append(allow, `"`+o+`"`)
 			}
-			if config.XContentTypeOptions {
-				w.Header().Set("X-Content-Type-Options", "nosniff")
+		}
+		features = append(features, fmt.Sprintf("%v=(%v)", k, strings.Join(allow, " ")))
+	}
+	return strings.Join(features, ", ")
+}
+
+// buildClearSiteData quotes and joins the data types.
+func buildClearSiteData(types []string) string {
+	q := make([]string, len(types))
+	for i, t := range types {
+		q[i] = `"` + strings.Trim(t, `"`) + `"`
+	}
+	return strings.Join(q, ", ")
+}
+
+// matchHosts reports if host matches any of the patterns.
+func matchHosts(patterns []string, host string) bool {
+	if len(patterns) == 0 {
+		return false
+	}
+
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(host)
+
+	for _, p := range patterns {
+		p = strings.ToLower(p)
+		if strings.HasPrefix(p, "*.") {
+			if strings.HasSuffix(host, p[1:]) {
+				return true
 			}
+			continue
+		}
+		if host == p {
+			return true
+		}
+	}
+	return false
+}
 
-			next.ServeHTTP(w, r)
-		})
+func inSlice(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
 	}
+	return false
 }
@@ -3,7 +3,10 @@ package securityMiddleware
 import (
 	"fmt"
 	"net/http"
+	"net/http/httptest"
+	"reflect"
 	"testing"
+	"time"
 
 	"github.com/teamwork/test"
 )
@@ -20,9 +23,22 @@ func Test(t *testing.T) {
 	}{
 		{Config{}, http.Header{}},
 		{DefaultConfig, http.Header{
-			"Strict-Transport-Security": []string{"max-age=2592000"},
-			"X-Frame-Options":           []string{"SAMEORIGIN"},
-			"X-Content-Type-Options":    []string{"nosniff"}},
+			"Strict-Transport-Security":         []string{"max-age=2592000"},
+			"X-Frame-Options":                   []string{"SAMEORIGIN"},
+			"X-Content-Type-Options":            []string{"nosniff"},
+			"Referrer-Policy":                   []string{"strict-origin-when-cross-origin"},
+			"X-Permitted-Cross-Domain-Policies": []string{"none"},
+			"X-Download-Options":                []string{"noopen"}},
+		},
+		{
+			Config{
+				XPermittedCrossDomainPolicies: "master-only",
+				XDownloadOptions:              "noopen",
+			},
+			http.Header{
+				"X-Permitted-Cross-Domain-Policies": []string{"master-only"},
+				"X-Download-Options":                []string{"noopen"},
+			},
 		},
 		{
 			Config{
@@ -56,6 +72,73 @@ func Test(t *testing.T) {
 				"Strict-Transport-Security": []string{"max-age=666"},
 			},
 		},
+		{
+			Config{
+				HSTS: &HSTS{MaxAge: 180 * 24 * time.Hour, IncludeSubDomains: true, Preload: true},
+			},
+			http.Header{
+				"Strict-Transport-Security": []string{"max-age=15552000; includeSubDomains; preload"},
+			},
+		},
+		{
+			Config{
+				StrictTransportSecurity: "max-age=666",
+				HSTS:                    &HSTS{MaxAge: time.Hour},
+			},
+			http.Header{
+				"Strict-Transport-Security": []string{"max-age=3600"},
+			},
+		},
+		{
+			Config{
+				ReferrerPolicy: "no-referrer, strict-origin-when-cross-origin",
+			},
+			http.Header{
+				"Referrer-Policy": []string{"no-referrer, strict-origin-when-cross-origin"},
+			},
+		},
+		{
+			Config{
+				PermissionsPolicy: map[string][]string{
+					"geolocation": []string{"self", "https://example.com"},
+					"camera":      []string{},
+					"microphone":  nil,
+					"fullscreen":  []string{"*"},
+				},
+			},
+			http.Header{
+				"Permissions-Policy": []string{
+					`camera=(), fullscreen=(*), geolocation=(self "https://example.com"), microphone=()`},
+			},
+		},
+		{
+			Config{PermissionsPolicy: map[string][]string{}},
+			http.Header{},
+		},
+		{
+			Config{CrossOriginOpenerPolicy: "same-origin"},
+			http.Header{"Cross-Origin-Opener-Policy": []string{"same-origin"}},
+		},
+		{
+			Config{CrossOriginEmbedderPolicy: "require-corp"},
+			http.Header{"Cross-Origin-Embedder-Policy": []string{"require-corp"}},
+		},
+		{
+			Config{CrossOriginResourcePolicy: "same-site"},
+			http.Header{"Cross-Origin-Resource-Policy": []string{"same-site"}},
+		},
+		{
+			Config{
+				CrossOriginOpenerPolicy:   "same-origin",
+				CrossOriginEmbedderPolicy: "require-corp",
+				CrossOriginResourcePolicy: "same-origin",
+			},
+			http.Header{
+				"Cross-Origin-Opener-Policy":   []string{"same-origin"},
+				"Cross-Origin-Embedder-Policy": []string{"require-corp"},
+				"Cross-Origin-Resource-Policy": []string{"same-origin"},
+			},
+		},
 	}
 
 	for i, tc := range cases {
@@ -64,10 +147,354 @@ func Test(t *testing.T) {
 			rr := test.HTTP(t, req, WithConfig(tc.in, "example.com")(handle{}).ServeHTTP)
 			out := rr.Header()
 			out.Del("Content-Type")
-			// TODO: we use a map so order isn't guaranteed :-/
-			//If !reflect.DeepEqual(tc.want, out) {
-			//	t.Errorf("\nout:  %#v\nwant: %#v\n", out, tc.want)
-			//}
+			if !reflect.DeepEqual(tc.want, out) {
+				t.Errorf("\nout:  %#v\nwant: %#v\n", out, tc.want)
+			}
+		})
+	}
+}
+
+func TestHSTSHosts(t *testing.T) {
+	cases := []struct {
+		host string
+		want bool
+	}{
+		{"example.com", true},
+		{"www.example.com", true},
+		{"custom.org", true},
+		{"custom.org:8080", true},
+		{"CUSTOM.org", true},
+		{"www.custom.org", false},
+		{"white.label.net", true},
+		{"label.net", false},
+		{"other.org", false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.host, func(t *testing.T) {
+			req := &http.Request{Host: tc.host}
+			rr := test.HTTP(t, req, WithConfig(Config{
+				StrictTransportSecurity: "max-age=666",
+				HSTSHosts:               []string{"custom.org", "*.label.net"},
+			}, "example.com")(handle{}).ServeHTTP)
+
+			out := rr.Header().Get("Strict-Transport-Security") != ""
+			if out != tc.want {
+				t.Errorf("out: %t; want: %t", out, tc.want)
+			}
+		})
+	}
+}
+
+func TestClearSiteData(t *testing.T) {
+	mw := WithConfig(Config{
+		ClearSiteData: func(r *http.Request) []string {
+			switch r.URL.Path {
+			case "/logout":
+				return []string{"cookies", "storage"}
+			case "/reset":
+				return []string{"*"}
+			}
+			return nil
+		},
+	}, "example.com")
+
+	cases := []struct {
+		path, want string
+	}{
+		{"/logout", `"cookies", "storage"`},
+		{"/reset", `"*"`},
+		{"/", ""},
+		{"/logout/other", ""},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.path, func(t *testing.T) {
+			req, err := http.NewRequest("GET", tc.path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := test.HTTP(t, req, mw(handle{}).ServeHTTP)
+			h, ok := rr.Header()["Clear-Site-Data"]
+			if tc.want == "" {
+				if ok {
+					t.Errorf("header set: %#v", h)
+				}
+				return
+			}
+			if rr.Header().Get("Clear-Site-Data") != tc.want {
+				t.Errorf("\nout:  %#v\nwant: %#v\n", h, tc.want)
+			}
+		})
+	}
+}
+
+func TestSkipper(t *testing.T) {
+	config := DefaultConfig
+	config.Skipper = func(r *http.Request) bool { return r.URL.Path == "/healthz" }
+	mw := WithConfig(config, "example.com")
+
+	cases := []struct {
+		path string
+		want bool
+	}{
+		{"/", true},
+		{"/healthz", false},
+		{"/healthz/other", true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.path, func(t *testing.T) {
+			req, err := http.NewRequest("GET", "https://example.com"+tc.path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := test.HTTP(t, req, mw(handle{}).ServeHTTP)
+			for _, h := range []string{"X-Frame-Options", "Strict-Transport-Security",
+				"X-Content-Type-Options", "Referrer-Policy"} {
+				if out := rr.Header().Get(h) != ""; out != tc.want {
+					t.Errorf("%v: out: %t; want: %t", h, out, tc.want)
+				}
+			}
+			if b := rr.Body.String(); b != "handler" {
+				t.Errorf("body wrong: %#v", b)
+			}
+		})
+	}
+}
+
+func TestWithConfigFunc(t *testing.T) {
+	brand := Config{
+		XFrameOptions: "DENY",
+		CSPNonce:      true,
+		ContentSecurityPolicy: map[string][]string{
+			"script-src": []string{NoncePlaceholder},
+		},
+	}
+
+	var nonce string
+	mw := WithConfigFunc(func(r *http.Request) *Config {
+		if r.Host == "brand.com" {
+			return &brand
+		}
+		return nil
+	}, "example.com")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		nonce = Nonce(r)
+	}))
+
+	rr := test.HTTP(t, &http.Request{Host: "example.com"}, mw.ServeHTTP)
+	if h := rr.Header().Get("X-Frame-Options"); h != "SAMEORIGIN" {
+		t.Errorf("wrong X-Frame-Options for default: %#v", h)
+	}
+	if h := rr.Header().Get("Strict-Transport-Security"); h != "max-age=2592000" {
+		t.Errorf("wrong Strict-Transport-Security for default: %#v", h)
+	}
+	if nonce != "" {
+		t.Errorf("nonce set for default: %#v", nonce)
+	}
+
+	rr = test.HTTP(t, &http.Request{Host: "brand.com"}, mw.ServeHTTP)
+	if h := rr.Header().Get("X-Frame-Options"); h != "DENY" {
+		t.Errorf("wrong X-Frame-Options for brand.com: %#v", h)
+	}
+	if h := rr.Header().Get("Strict-Transport-Security"); h != "" {
+		t.Errorf("wrong Strict-Transport-Security for brand.com: %#v", h)
+	}
+	want := "script-src 'nonce-" + nonce + "';"
+	if h := rr.Header().Get("Content-Security-Policy"); nonce == "" || h != want {
+		t.Errorf("wrong Content-Security-Policy for brand.com\nout:  %#v\nwant: %#v\n", h, want)
+	}
+}
+
+func TestWithConfigFuncCache(t *testing.T) {
+	brand := Config{XFrameOptions: "DENY"}
+	invalid := Config{XFrameOptions: "ALLOWALL"}
+	mw := WithConfigFunc(func(r *http.Request) *Config {
+		if r.Host == "brand.com" {
+			return &brand
+		}
+		return &invalid
+	}, "example.com")(handle{})
+
+	rr := test.HTTP(t, &http.Request{Host: "brand.com"}, mw.ServeHTTP)
+	if h := rr.Header().Get("X-Frame-Options"); h != "DENY" {
+		t.Errorf("wrong X-Frame-Options: %#v", h)
+	}
+
+	// The policy is built on first use, so later changes aren't seen.
+	brand.XFrameOptions = "SAMEORIGIN"
+	rr = test.HTTP(t, &http.Request{Host: "brand.com"}, mw.ServeHTTP)
+	if h := rr.Header().Get("X-Frame-Options"); h != "DENY" {
+		t.Errorf("policy not cached: %#v", h)
+	}
+
+	for i := 0; i < 2; i++ {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("no panic for request %d", i)
+				}
+			}()
+			mw.ServeHTTP(httptest.NewRecorder(), &http.Request{Host: "invalid.com"})
+		}()
+	}
+}
+
+func TestWithConfigFuncCacheBounded(t *testing.T) {
+	cache := &policyCache{}
+	mw := withConfigFunc(func(r *http.Request) *Config {
+		return &Config{XFrameOptions: "DENY"}
+	}, "example.com", cache)(handle{})
+
+	for i := 0; i < maxCachedPolicies*2+10; i++ {
+		rr := test.HTTP(t, &http.Request{Host: "example.com"}, mw.ServeHTTP)
+		if h := rr.Header().Get("X-Frame-Options"); h != "DENY" {
+			t.Fatalf("wrong X-Frame-Options: %#v", h)
+		}
+		if len(cache.m) > maxCachedPolicies {
+			t.Fatalf("cache not bounded: %d entries", len(cache.m))
+		}
+	}
+}
+
+func TestInvalidConfig(t *testing.T) {
+	cases := []struct {
+		in     Config
+		strict bool // Only rejected by New().
+	}{
+		{Config{ReferrerPolicy: "same-site"}, false},
+		{Config{ReferrerPolicy: "no-referrer,"}, false},
+		{Config{HSTS: &HSTS{MaxAge: time.Hour, Preload: true}}, false},
+		{Config{HSTS: &HSTS{MaxAge: -time.Hour}}, false},
+		{Config{XFrameOptions: "ALLOWALL"}, true},
+		{Config{XFrameOptions: "DENY SAMEORIGIN"}, true},
+		{Config{XFrameOptions: "ALLOW-FROM"}, true},
+		{Config{XFrameOptions: "ALLOW-FROM example.com"}, true},
+		{Config{ContentSecurityPolicy: map[string][]string{"script-src": {"'self'; img-src *"}}}, true},
+		{Config{ContentSecurityPolicy: map[string][]string{"script-src": {"'self'\r\nSet-Cookie: x=y"}}}, true},
+		{Config{ContentSecurityPolicy: map[string][]string{"script-src": {"'self', script-src *"}}}, true},
+		{Config{ContentSecurityPolicyReportOnly: map[string][]string{"script-src; img-src": {"*"}}}, true},
+		{Config{ContentSecurityPolicyReportOnly: map[string][]string{"": {"*"}}}, true},
+		{Config{CSPHeader: "default-src 'self';\nSet-Cookie: x=y"}, true},
+		{Config{CSPReportOnlyHeader: "default-src 'self';\x00"}, true},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%v", i), func(t *testing.T) {
+			mw, err := New(tc.in, "example.com")
+			if err == nil || mw != nil {
+				t.Errorf("no error for %#v", tc.in)
+			}
+
+			defer func() {
+				if rec := recover(); (rec == nil) != tc.strict {
+					t.Errorf("panic for %#v: %v; want panic: %t", tc.in, rec, !tc.strict)
+				}
+			}()
+			WithConfig(tc.in, "example.com")
 		})
 	}
 }
+
+func TestWithConfigLenient(t *testing.T) {
+	rr := test.HTTP(t, &http.Request{Host: "example.com"}, WithConfig(Config{
+		XFrameOptions:                   "ALLOW-FROM example.com",
+		FrameAncestorsFromXFrameOptions: true,
+		ContentSecurityPolicy:           map[string][]string{"script-src": {"'self', https://example.com"}},
+	}, "example.com")(handle{}).ServeHTTP)
+
+	if h := rr.Header().Get("X-Frame-Options"); h != "ALLOW-FROM example.com" {
+		t.Errorf("X-Frame-Options: %#v", h)
+	}
+	if h := rr.Header().Get("Content-Security-Policy"); h != "script-src 'self', https://example.com;" {
+		t.Errorf("Content-Security-Policy: %#v", h)
+	}
+}
+
+func TestFrameAncestors(t *testing.T) {
+	cases := []struct {
+		in   Config
+		want string
+	}{
+		{Config{XFrameOptions: "DENY", FrameAncestorsFromXFrameOptions: true}, ""},
+		{Config{XFrameOptions: "ALLOW-FROM https://example.com/"}, ""},
+		{
+			Config{XFrameOptions: "ALLOW-FROM https://example.com/", FrameAncestorsFromXFrameOptions: true},
+			"frame-ancestors https://example.com/;",
+		},
+		{
+			Config{
+				XFrameOptions:                   "allow-from https://example.com/",
+				FrameAncestorsFromXFrameOptions: true,
+				ContentSecurityPolicy:           map[string][]string{"default-src": []string{"'self'"}},
+			},
+			"default-src 'self'; frame-ancestors https://example.com/;",
+		},
+		{
+			Config{
+				XFrameOptions:                   "ALLOW-FROM https://example.com/",
+				FrameAncestorsFromXFrameOptions: true,
+				ContentSecurityPolicy:           map[string][]string{"frame-ancestors": []string{"'none'"}},
+			},
+			"frame-ancestors 'none';",
+		},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%v", i), func(t *testing.T) {
+			mw, err := New(tc.in, "example.com")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := test.HTTP(t, &http.Request{Host: "example.com"}, mw(handle{}).ServeHTTP)
+			if h := rr.Header().Get("Content-Security-Policy"); h != tc.want {
+				t.Errorf("\nout:  %#v\nwant: %#v\n", h, tc.want)
+			}
+		})
+	}
+}
+
+func TestFrameAncestorsInjection(t *testing.T) {
+	for _, xfo := range []string{
+		"ALLOW-FROM https://x.com/;script-src",
+		"ALLOW-FROM https://x.com/,script-src",
+	} {
+		t.Run(xfo, func(t *testing.T) {
+			mw, err := New(Config{XFrameOptions: xfo, FrameAncestorsFromXFrameOptions: true}, "example.com")
+			if err == nil || mw != nil {
+				t.Errorf("no error for %q", xfo)
+			}
+		})
+	}
+}
+
+func TestCSPOrder(t *testing.T) {
+	policy := map[string][]string{
+		"script-src":  []string{"'self'"},
+		"default-src": []string{"'none'"},
+		"img-src":     []string{"'self'", "data:"},
+		"style-src":   []string{"'self'"},
+		"connect-src": []string{"'self'"},
+		"font-src":    []string{"https://fonts.example.com"},
+	}
+	want := "connect-src 'self'; default-src 'none'; font-src https://fonts.example.com; " +
+		"img-src 'self' data:; script-src 'self'; style-src 'self';"
+
+	for i := 0; i < 20; i++ {
+		req := &http.Request{Host: "example.com"}
+		rr := test.HTTP(t, req, WithConfig(Config{
+			ContentSecurityPolicy:           policy,
+			ContentSecurityPolicyReportOnly: policy,
+		}, "example.com")(handle{}).ServeHTTP)
+
+		if h := rr.Header().Get("Content-Security-Policy"); h != want {
+			t.Fatalf("Content-Security-Policy\nout:  %#v\nwant: %#v\n", h, want)
+		}
+		if h := rr.Header().Get("Content-Security-Policy-Report-Only"); h != want {
+			t.Fatalf("Content-Security-Policy-Report-Only\nout:  %#v\nwant: %#v\n", h, want)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package securityMiddleware
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+)
+
+// responseWriter calls beforeWrite just before the headers are sent, so we can
+// change headers set by the handler.
+type responseWriter struct {
+	http.ResponseWriter
+	beforeWrite func(http.Header)
+	wroteHeader bool
+	hijacked    bool
+}
+
+func (w *responseWriter) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		w.beforeWrite(w.Header())
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *responseWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush implements http.Flusher.
+func (w *responseWriter) Flush() {
+	f, ok := w.ResponseWriter.(http.Flusher)
+	if !ok {
+		return
+	}
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	f.Flush()
+}
+
+// Hijack implements http.Hijacker.
+func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("securityMiddleware: %T is not a http.Hijacker", w.ResponseWriter)
+	}
+	w.hijacked = true
+	return h.Hijack()
+}
+
+// finish runs beforeWrite if the handler didn't write anything, since net/http
+// will send the headers after the handler returns.
+func (w *responseWriter) finish() {
+	if !w.wroteHeader && !w.hijacked {
+		w.wroteHeader = true
+		w.beforeWrite(w.Header())
+	}
+}
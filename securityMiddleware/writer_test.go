@@ -0,0 +1,185 @@
+package securityMiddleware
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/teamwork/middleware/rescueMiddleware"
+	"github.com/teamwork/test"
+)
+
+func TestServerHeader(t *testing.T) {
+	cases := []struct {
+		config  string
+		handler http.HandlerFunc
+		want    []string
+	}{
+		{"", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Server", "Go")
+		}, []string{"Go"}},
+		{"nope", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Server", "Go")
+		}, []string{"nope"}},
+		{"nope", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Server", "Go")
+			w.WriteHeader(http.StatusNotFound)
+		}, []string{"nope"}},
+		{"nope", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Server", "Go")
+			_, _ = w.Write([]byte("x"))
+		}, []string{"nope"}},
+		{RemoveServerHeader, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Server", "Go")
+			_, _ = w.Write([]byte("x"))
+		}, nil},
+		{RemoveServerHeader, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Server", "Go")
+			w.(http.Flusher).Flush()
+		}, nil},
+		{RemoveServerHeader, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Server", "Go")
+		}, nil},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%v", i), func(t *testing.T) {
+			rr := test.HTTP(t, &http.Request{Host: "example.com"},
+				WithConfig(Config{ServerHeader: tc.config}, "example.com")(tc.handler).ServeHTTP)
+
+			// Result() has a snapshot of the headers at the time they were
+			// written.
+			if out := rr.Result().Header["Server"]; fmt.Sprint(out) != fmt.Sprint(tc.want) {
+				t.Errorf("\nout:  %#v\nwant: %#v\n", out, tc.want)
+			}
+		})
+	}
+}
+
+func TestCacheControl(t *testing.T) {
+	cases := []struct {
+		config     Config
+		handler    http.HandlerFunc
+		wantCache  string
+		wantPragma string
+	}{
+		{Config{}, handle{}.ServeHTTP, "", ""},
+		{Config{CacheControl: "private"}, handle{}.ServeHTTP, "private", ""},
+		{
+			Config{NoStore: true},
+			handle{}.ServeHTTP,
+			"no-store, no-cache, must-revalidate", "no-cache",
+		},
+		{
+			Config{NoStore: true, CacheControl: "private"},
+			handle{}.ServeHTTP,
+			"private", "",
+		},
+		{
+			Config{NoStore: true},
+			func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+				_, _ = w.Write([]byte("asset"))
+			},
+			"public, max-age=31536000, immutable", "",
+		},
+		{
+			Config{CacheControl: "private"},
+			func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Cache-Control", "public")
+			},
+			"public", "",
+		},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%v", i), func(t *testing.T) {
+			rr := test.HTTP(t, &http.Request{Host: "example.com"},
+				WithConfig(tc.config, "example.com")(tc.handler).ServeHTTP)
+
+			h := rr.Result().Header
+			if out := h.Get("Cache-Control"); out != tc.wantCache {
+				t.Errorf("Cache-Control\nout:  %#v\nwant: %#v\n", out, tc.wantCache)
+			}
+			if out := h.Get("Pragma"); out != tc.wantPragma {
+				t.Errorf("Pragma\nout:  %#v\nwant: %#v\n", out, tc.wantPragma)
+			}
+		})
+	}
+}
+
+func TestDontOverride(t *testing.T) {
+	relax := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Frame-Options", "ALLOW-FROM https://example.net/")
+		_, _ = w.Write([]byte("x"))
+	}
+	plain := func(w http.ResponseWriter, r *http.Request) {}
+
+	cases := []struct {
+		dontOverride bool
+		handler      http.HandlerFunc
+		wantXFO      string
+	}{
+		{false, relax, "ALLOW-FROM https://example.net/"},
+		{true, relax, "ALLOW-FROM https://example.net/"},
+		{true, plain, "SAMEORIGIN"},
+		{false, plain, "SAMEORIGIN"},
+	}
+
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%v", i), func(t *testing.T) {
+			config := DefaultConfig
+			config.DontOverride = tc.dontOverride
+			var before string
+			rr := test.HTTP(t, nil, WithConfig(config, "example.com")(
+				http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					before = w.Header().Get("X-Frame-Options")
+					tc.handler(w, r)
+				})).ServeHTTP)
+
+			h := rr.Result().Header
+			if xfo := h.Get("X-Frame-Options"); xfo != tc.wantXFO {
+				t.Errorf("X-Frame-Options: %q; want: %q", xfo, tc.wantXFO)
+			}
+			if nosniff := h.Get("X-Content-Type-Options"); nosniff != "nosniff" {
+				t.Errorf("X-Content-Type-Options: %q", nosniff)
+			}
+			if tc.dontOverride && before != "" {
+				t.Errorf("header set before handler: %q", before)
+			}
+			if !tc.dontOverride && before != "SAMEORIGIN" {
+				t.Errorf("header not set before handler: %q", before)
+			}
+		})
+	}
+}
+
+func TestPanic(t *testing.T) {
+	config := DefaultConfig
+	config.DontOverride = true
+	config.ServerHeader = "nope"
+	config.NoStore = true
+
+	mw := rescueMiddleware.WithConfig(rescueMiddleware.Config{
+		Log: func(*http.Request, error) {},
+	})(WithConfig(config, "example.com")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Server", "Go")
+		panic("oh noes")
+	})))
+	rr := test.HTTP(t, &http.Request{Host: "example.com"}, mw.ServeHTTP)
+
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("code: %v", rr.Code)
+	}
+	h := rr.Result().Header
+	for k, want := range map[string]string{
+		"X-Frame-Options": "SAMEORIGIN",
+		"Server":          "nope",
+		"Cache-Control":   "no-store, no-cache, must-revalidate",
+		"Pragma":          "no-cache",
+	} {
+		if out := h.Get(k); out != want {
+			t.Errorf("%v\nout:  %#v\nwant: %#v\n", k, out, want)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+// Package timeoutMiddleware limits the time a handler can take to respond.
+//
+// The handler runs with a context deadline, and if it doesn't finish in time a
+// 503 Service Unavailable response is sent. Handlers should check the request
+// context to stop work early.
+//
+// The response is buffered, so the handler can't stream data with Flush or
+// take over the connection with Hijack.
+//
+// Panics in the handler are re-panic()ed in the goroutine serving the
+// request, so add rescueMiddleware before this middleware (i.e. as the outer
+// handler) to recover them. Panics after the timeout can't be re-panic()ed as
+// the response is already sent, and are passed to Config.Log instead.
+package timeoutMiddleware // import "github.com/teamwork/middleware/timeoutMiddleware"
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/kr/pretty"
+)
+
+// Config for the middleware.
+type Config struct {
+	// Timeout for the handler. This is required.
+	Timeout time.Duration
+
+	// Status code to send on timeout; the default is 503 Service Unavailable.
+	Status int
+
+	// Message to send on timeout.
+	Message string
+
+	// Log panics that happen after the timeout; the default is to print them
+	// to stderr.
+	Log func(*http.Request, error)
+}
+
+// DefaultConfig is the default timeout middleware config.
+var DefaultConfig = Config{
+	Timeout: 30 * time.Second,
+	Status:  http.StatusServiceUnavailable,
+	Message: "Sorry, the server took too long to respond.",
+}
+
+// WithConfig returns a timeout middleware from config.
+//
+// It will panic if the Timeout isn't positive.
+func WithConfig(config Config) func(http.Handler) http.Handler {
+	if config.Timeout <= 0 {
+		panic(fmt.Sprintf("timeoutMiddleware: invalid timeout %v", config.Timeout))
+	}
+	if config.Status == 0 {
+		config.Status = DefaultConfig.Status
+	}
+	if config.Message == "" {
+		config.Message = DefaultConfig.Message
+	}
+	if config.Log == nil {
+		config.Log = defaultLog
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, cancel := context.WithTimeout(r.Context(), config.Timeout)
+			defer cancel()
+			r = r.WithContext(ctx)
+
+			tw := &timeoutWriter{h: make(http.Header)}
+			done := make(chan struct{})
+			panicked := make(chan interface{}, 1)
+			go func() {
+				defer func() {
+					if rec := recover(); rec != nil {
+						tw.mu.Lock()
+						defer tw.mu.Unlock()
+						if tw.timedOut {
+							config.logLate(r, rec)
+							return
+						}
+						panicked <- rec
+					}
+				}()
+				next.ServeHTTP(tw, r)
+				close(done)
+			}()
+
+			select {
+			case rec := <-panicked:
+				panic(rec)
+			case <-done:
+				tw.mu.Lock()
+				defer tw.mu.Unlock()
+				dst := w.Header()
+				for k, v := range tw.h {
+					dst[k] = v
+				}
+				if tw.status == 0 {
+					tw.status = http.StatusOK
+				}
+				w.WriteHeader(tw.status)
+				w.Write(tw.buf.Bytes()) // nolint: errcheck
+			case <-ctx.Done():
+				tw.mu.Lock()
+				defer tw.mu.Unlock()
+				// The handler may have finished or panicked just as the
+				// timeout expired; the timeout wins.
+				tw.timedOut = true
+				select {
+				case rec := <-panicked:
+					config.logLate(r, rec)
+				default:
+				}
+				w.WriteHeader(config.Status)
+				w.Write([]byte(config.Message)) // nolint: errcheck
+			}
+		})
+	}
+}
+
+// timeoutWriter buffers the response, and discards writes after the timeout.
+type timeoutWriter struct {
+	mu       sync.Mutex
+	h        http.Header
+	buf      bytes.Buffer
+	status   int
+	timedOut bool
+}
+
+func (w *timeoutWriter) Header() http.Header { return w.h }
+
+func (w *timeoutWriter) WriteHeader(code int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.timedOut || w.status != 0 {
+		return
+	}
+	w.status = code
+}
+
+func (w *timeoutWriter) Write(b []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.buf.Write(b)
+}
+
+// logLate logs a panic that happened after the timeout.
+func (config Config) logLate(r *http.Request, rec interface{}) {
+	config.Log(r, pretty.Errorf("timeoutMiddleware: panic after timeout: %v", rec))
+}
+
+func defaultLog(r *http.Request, err error) {
+	fmt.Fprintf(os.Stderr, "%v", err)
+}
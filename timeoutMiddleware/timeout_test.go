@@ -0,0 +1,93 @@
+package timeoutMiddleware
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/teamwork/test"
+)
+
+type handle struct{}
+
+func (h handle) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	_, _ = w.Write([]byte("handler"))
+}
+
+func TestTimeout(t *testing.T) {
+	t.Run("fast", func(t *testing.T) {
+		rr := test.HTTP(t, nil, WithConfig(Config{Timeout: time.Second})(
+			http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("X-Foo", "bar")
+				w.WriteHeader(http.StatusCreated)
+				_, _ = w.Write([]byte("handler"))
+			})).ServeHTTP)
+
+		if rr.Code != http.StatusCreated {
+			t.Errorf("code: %v", rr.Code)
+		}
+		if h := rr.Header().Get("X-Foo"); h != "bar" {
+			t.Errorf("header: %q", h)
+		}
+		if b := rr.Body.String(); b != "handler" {
+			t.Errorf("body: %q", b)
+		}
+	})
+
+	t.Run("slow", func(t *testing.T) {
+		var (
+			ctxErr   = make(chan error, 1)
+			writeErr = make(chan error, 1)
+		)
+		rr := test.HTTP(t, nil, WithConfig(Config{
+			Timeout: 10 * time.Millisecond,
+			Status:  http.StatusGatewayTimeout,
+			Message: "too slow",
+		})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-r.Context().Done()
+			ctxErr <- r.Context().Err()
+
+			// Wait for the timeout response to be written.
+			time.Sleep(10 * time.Millisecond)
+			w.WriteHeader(http.StatusOK)
+			_, err := w.Write([]byte("handler"))
+			writeErr <- err
+		})).ServeHTTP)
+
+		if rr.Code != http.StatusGatewayTimeout {
+			t.Errorf("code: %v", rr.Code)
+		}
+		if b := rr.Body.String(); b != "too slow" {
+			t.Errorf("body: %q", b)
+		}
+		if err := <-ctxErr; err == nil {
+			t.Error("context not cancelled")
+		}
+		if err := <-writeErr; err != http.ErrHandlerTimeout {
+			t.Errorf("wrong write error: %v", err)
+		}
+	})
+}
+
+func TestPanic(t *testing.T) {
+	defer func() {
+		if rec := recover(); rec != "oh noes" {
+			t.Errorf("wrong recovered value: %#v", rec)
+		}
+	}()
+
+	test.HTTP(t, nil, WithConfig(Config{Timeout: time.Second})(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			panic("oh noes")
+		})).ServeHTTP)
+	t.Error("didn't panic")
+}
+
+func TestInvalidConfig(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("didn't panic")
+		}
+	}()
+	WithConfig(Config{})
+}